@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+func init() {
+	registerFeedParser(feedParser{
+		name:         "Atom 1.0",
+		contentTypes: []string{"application/atom+xml"},
+		sniff: func(dat []byte) bool {
+			root, err := xmlRootElement(dat)
+			return err == nil && root.Local == "feed" && (root.Space == atomNamespace || root.Space == "")
+		},
+		parse: parseAtomFeed,
+	})
+}
+
+type AtomFeed struct {
+	Title string      `xml:"title"`
+	Link  []AtomLink  `xml:"link"`
+	Entry []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       []AtomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    AtomText       `xml:"summary"`
+	Content    AtomText       `xml:"content"`
+	Author     []AtomPerson   `xml:"author"`
+	Categories []AtomCategory `xml:"category"`
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// AtomText is a text construct, its content is escaped text or HTML,
+// or inline XHTML markup
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+type AtomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+func (text AtomText) String() string {
+	if text.Type == "xhtml" {
+		return strings.TrimSpace(text.InnerXML)
+	}
+	return strings.TrimSpace(text.Text)
+}
+
+func parseAtomFeed(dat []byte) (RSSFeed, error) {
+	atomFeed := AtomFeed{}
+	err := xml.Unmarshal(dat, &atomFeed)
+	if err != nil {
+		return RSSFeed{}, err
+	}
+
+	// normalize the Atom document into the RSS shape used by the scraper
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = atomFeed.Title
+	rssFeed.Channel.Link = atomAlternateLink(atomFeed.Link)
+	for _, entry := range atomFeed.Entry {
+		item := RSSItem{
+			Title:       entry.Title,
+			Link:        atomAlternateLink(entry.Link),
+			PubDate:     entry.Published,
+			GUID:        RSSGUID{Value: entry.ID, IsPermaLink: "false"},
+			Updated:     entry.Updated,
+			Description: entry.Summary.String(),
+			Content:     entry.Content.String(),
+		}
+		for _, author := range entry.Author {
+			if author.Name != "" {
+				item.Creator = author.Name
+				break
+			}
+		}
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, category.Term)
+		}
+		for _, link := range entry.Link {
+			switch link.Rel {
+			case "enclosure":
+				item.Enclosures = append(item.Enclosures, RSSEnclosure{URL: link.Href, Type: link.Type, Length: link.Length})
+			case "replies":
+				if link.Type == "" || link.Type == "text/html" {
+					item.Comments = link.Href
+				}
+			}
+		}
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, item)
+	}
+	return rssFeed, nil
+}
+
+// atomAlternateLink returns the link pointing to the HTML version of an
+// entry, a link without rel is an alternate link as per RFC 4287
+func atomAlternateLink(links []AtomLink) string {
+	alternate := ""
+	for _, link := range links {
+		if link.Rel != "" && link.Rel != "alternate" {
+			continue
+		}
+		if link.Type == "" || link.Type == "text/html" {
+			return link.Href
+		}
+		if alternate == "" {
+			alternate = link.Href
+		}
+	}
+	return alternate
+}
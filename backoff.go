@@ -0,0 +1,41 @@
+package main
+
+import "time"
+
+// failing feeds are retried after an exponentially growing delay and
+// disabled once they failed too many times in a row
+const fetchBackoffBase = time.Minute
+const fetchBackoffMax = 24 * time.Hour
+const maxFetchFailures = 15
+
+// fetchBackoff returns how long to wait before fetching a feed again
+// after it failed the given number of times in a row
+func fetchBackoff(failures int32) time.Duration {
+	backoff := fetchBackoffBase
+	for i := int32(1); i < failures; i++ {
+		backoff *= 2
+		if backoff >= fetchBackoffMax {
+			return fetchBackoffMax
+		}
+	}
+	return backoff
+}
+
+// failed deliveries to webhooks are retried after an exponentially growing
+// delay and given up after too many attempts
+const webhookBackoffBase = 30 * time.Second
+const webhookBackoffMax = 6 * time.Hour
+const maxWebhookAttempts = 10
+
+// webhookBackoff returns how long to wait before delivering to a webhook
+// again after the given number of failed attempts
+func webhookBackoff(attempts int32) time.Duration {
+	backoff := webhookBackoffBase
+	for i := int32(1); i < attempts; i++ {
+		backoff *= 2
+		if backoff >= webhookBackoffMax {
+			return webhookBackoffMax
+		}
+	}
+	return backoff
+}
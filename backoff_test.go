@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFetchBackoff(t *testing.T) {
+	tests := map[int32]time.Duration{
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		3:  4 * time.Minute,
+		10: 512 * time.Minute,
+		11: 1024 * time.Minute,
+		12: 24 * time.Hour,
+		50: 24 * time.Hour,
+	}
+	for failures, want := range tests {
+		if got := fetchBackoff(failures); got != want {
+			t.Errorf("Wrong backoff after %v failures, got: %v want: %v", failures, got, want)
+		}
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := map[int32]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		9:  128 * time.Minute,
+		10: 256 * time.Minute,
+		11: 6 * time.Hour,
+		50: 6 * time.Hour,
+	}
+	for attempts, want := range tests {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("Wrong backoff after %v attempts, got: %v want: %v", attempts, got, want)
+		}
+	}
+}
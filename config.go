@@ -0,0 +1,371 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// config of the service. Settings are read from, in increasing order of
+// precedence: the defaults below, an optional YAML file, environment
+// variables and command line flags.
+type config struct {
+	// DSN of the Postgres database. If empty, the database of the
+	// docker compose setup is used with the password read from
+	// DatabasePasswordFile.
+	DatabaseURL          string `yaml:"database_url"`
+	DatabasePasswordFile string `yaml:"database_password_file"`
+	// address the HTTP server listens on
+	ListenAddr string `yaml:"listen_addr"`
+	// URL clients reach the service at, which links handed out by the API,
+	// e.g. to output feeds, start with. If empty, it's taken from requests.
+	PublicURL string `yaml:"public_url"`
+	// whether the X-Forwarded-Proto and X-Forwarded-Host headers of requests
+	// are trusted, which is only safe behind a proxy that sets them
+	TrustProxyHeaders bool          `yaml:"trust_proxy_headers"`
+	Scraper           scraperConfig `yaml:"scraper"`
+	// origins allowed to make cross-origin requests to the API
+	CORSOrigins []string `yaml:"cors_origins"`
+	// one of debug, info, warn or error
+	LogLevel string `yaml:"log_level"`
+}
+
+type scraperConfig struct {
+	// number of workers scraping feeds in parallel
+	Concurrency int `yaml:"concurrency"`
+	// number of feeds of the same host scraped in parallel
+	PerHostConcurrency int `yaml:"per_host_concurrency"`
+	// requests per second sent to the same host, in bursts of up to
+	// PerHostBurst requests
+	PerHostRate  float64 `yaml:"per_host_rate"`
+	PerHostBurst int     `yaml:"per_host_burst"`
+	// limits overriding the per host defaults for domains and their subdomains
+	Hosts map[string]hostLimits `yaml:"hosts"`
+	// time between checks for due feeds while no feeds are due, and the
+	// minimum time between two fetches of a feed
+	Interval time.Duration `yaml:"interval"`
+	// timeout for fetching a single feed
+	HTTPTimeout time.Duration `yaml:"http_timeout"`
+	// how long a feed stays leased to the replica scraping it, a feed
+	// leased by a crashed replica is scraped again after that time
+	LeaseDuration time.Duration `yaml:"lease_duration"`
+	// User-Agent sent with the requests for feeds
+	UserAgent string `yaml:"user_agent"`
+	// max size of a feed document in bytes, after decompression
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// max number of redirects followed when fetching a feed
+	MaxRedirects int `yaml:"max_redirects"`
+	// hostnames, IP addresses and CIDR ranges of the internal network that
+	// feeds may be fetched from, e.g. for intranet feeds
+	AllowedHosts []string `yaml:"allowed_hosts"`
+}
+
+func defaultConfig() config {
+	return config{
+		DatabasePasswordFile: "/run/secrets/db-password",
+		ListenAddr:           ":80",
+		Scraper: scraperConfig{
+			Concurrency:        10,
+			PerHostConcurrency: 2,
+			PerHostRate:        1,
+			PerHostBurst:       2,
+			Interval:           time.Minute,
+			HTTPTimeout:        10 * time.Second,
+			LeaseDuration:      5 * time.Minute,
+			UserAgent:          "scraperss/1.0 (+https://github.com/hammadzf/scraperss)",
+			MaxBodySize:        10 << 20,
+			MaxRedirects:       5,
+		},
+		CORSOrigins: []string{"https://*", "http://*"},
+		LogLevel:    "info",
+	}
+}
+
+// loadConfig reads the config from the given config file, environment
+// and command line arguments
+func loadConfig(args []string, getenv func(string) string) (config, error) {
+	cfg := defaultConfig()
+
+	// flags are parsed first to find the config file, but applied last
+	flagCfg := defaultConfig()
+	var corsOrigins string
+	var allowedHosts string
+	fs := flag.NewFlagSet("scraperss", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("SCRAPERSS_CONFIG"), "path to a YAML config file (env SCRAPERSS_CONFIG)")
+	fs.StringVar(&flagCfg.DatabaseURL, "database-url", "", "Postgres connection URL (env DATABASE_URL)")
+	fs.StringVar(&flagCfg.DatabasePasswordFile, "database-password-file", flagCfg.DatabasePasswordFile, "file with the DB password, used if no database URL is set (env DATABASE_PASSWORD_FILE)")
+	fs.StringVar(&flagCfg.ListenAddr, "listen-addr", flagCfg.ListenAddr, "address of the HTTP server (env LISTEN_ADDR)")
+	fs.StringVar(&flagCfg.PublicURL, "public-url", "", "URL clients reach the service at (env PUBLIC_URL)")
+	fs.BoolVar(&flagCfg.TrustProxyHeaders, "trust-proxy-headers", false, "trust the X-Forwarded-Proto and X-Forwarded-Host headers (env TRUST_PROXY_HEADERS)")
+	fs.IntVar(&flagCfg.Scraper.Concurrency, "scraper-concurrency", flagCfg.Scraper.Concurrency, "number of feeds scraped in parallel (env SCRAPER_CONCURRENCY)")
+	fs.IntVar(&flagCfg.Scraper.PerHostConcurrency, "per-host-concurrency", flagCfg.Scraper.PerHostConcurrency, "number of feeds of the same host scraped in parallel (env SCRAPER_PER_HOST_CONCURRENCY)")
+	fs.Float64Var(&flagCfg.Scraper.PerHostRate, "per-host-rate", flagCfg.Scraper.PerHostRate, "requests per second sent to the same host (env SCRAPER_PER_HOST_RATE)")
+	fs.IntVar(&flagCfg.Scraper.PerHostBurst, "per-host-burst", flagCfg.Scraper.PerHostBurst, "bursts of requests sent to the same host (env SCRAPER_PER_HOST_BURST)")
+	fs.DurationVar(&flagCfg.Scraper.Interval, "scraper-interval", flagCfg.Scraper.Interval, "time between checks for due feeds (env SCRAPER_INTERVAL)")
+	fs.DurationVar(&flagCfg.Scraper.HTTPTimeout, "http-timeout", flagCfg.Scraper.HTTPTimeout, "timeout for fetching a feed (env SCRAPER_HTTP_TIMEOUT)")
+	fs.DurationVar(&flagCfg.Scraper.LeaseDuration, "lease-duration", flagCfg.Scraper.LeaseDuration, "how long a feed stays leased to the scraping replica (env SCRAPER_LEASE_DURATION)")
+	fs.StringVar(&flagCfg.Scraper.UserAgent, "user-agent", flagCfg.Scraper.UserAgent, "User-Agent sent with requests for feeds (env SCRAPER_USER_AGENT)")
+	fs.Int64Var(&flagCfg.Scraper.MaxBodySize, "max-body-size", flagCfg.Scraper.MaxBodySize, "max size of a feed in bytes (env SCRAPER_MAX_BODY_SIZE)")
+	fs.IntVar(&flagCfg.Scraper.MaxRedirects, "max-redirects", flagCfg.Scraper.MaxRedirects, "max number of redirects followed when fetching a feed (env SCRAPER_MAX_REDIRECTS)")
+	fs.StringVar(&allowedHosts, "allowed-hosts", strings.Join(flagCfg.Scraper.AllowedHosts, ","), "comma-separated internal hosts feeds may be fetched from (env SCRAPER_ALLOWED_HOSTS)")
+	fs.StringVar(&corsOrigins, "cors-origins", strings.Join(flagCfg.CORSOrigins, ","), "comma-separated allowed CORS origins (env CORS_ORIGINS)")
+	fs.StringVar(&flagCfg.LogLevel, "log-level", flagCfg.LogLevel, "debug, info, warn or error (env LOG_LEVEL)")
+	err := fs.Parse(args)
+	if err != nil {
+		return config{}, err
+	}
+
+	// config file
+	if *configFile != "" {
+		dat, err := os.ReadFile(*configFile)
+		if err != nil {
+			return config{}, fmt.Errorf("couldn't read config file: %w", err)
+		}
+		err = yaml.Unmarshal(dat, &cfg)
+		if err != nil {
+			return config{}, fmt.Errorf("couldn't parse config file %s: %w", *configFile, err)
+		}
+	}
+
+	// environment variables
+	if val := getenv("DATABASE_URL"); val != "" {
+		cfg.DatabaseURL = val
+	}
+	if val := getenv("DATABASE_PASSWORD_FILE"); val != "" {
+		cfg.DatabasePasswordFile = val
+	}
+	if val := getenv("LISTEN_ADDR"); val != "" {
+		cfg.ListenAddr = val
+	}
+	if val := getenv("PUBLIC_URL"); val != "" {
+		cfg.PublicURL = val
+	}
+	if val := getenv("TRUST_PROXY_HEADERS"); val != "" {
+		cfg.TrustProxyHeaders, err = strconv.ParseBool(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid TRUST_PROXY_HEADERS: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_CONCURRENCY"); val != "" {
+		cfg.Scraper.Concurrency, err = strconv.Atoi(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_CONCURRENCY: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_PER_HOST_CONCURRENCY"); val != "" {
+		cfg.Scraper.PerHostConcurrency, err = strconv.Atoi(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_PER_HOST_CONCURRENCY: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_PER_HOST_RATE"); val != "" {
+		cfg.Scraper.PerHostRate, err = strconv.ParseFloat(val, 64)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_PER_HOST_RATE: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_PER_HOST_BURST"); val != "" {
+		cfg.Scraper.PerHostBurst, err = strconv.Atoi(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_PER_HOST_BURST: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_INTERVAL"); val != "" {
+		cfg.Scraper.Interval, err = time.ParseDuration(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_INTERVAL: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_HTTP_TIMEOUT"); val != "" {
+		cfg.Scraper.HTTPTimeout, err = time.ParseDuration(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_HTTP_TIMEOUT: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_LEASE_DURATION"); val != "" {
+		cfg.Scraper.LeaseDuration, err = time.ParseDuration(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_LEASE_DURATION: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_USER_AGENT"); val != "" {
+		cfg.Scraper.UserAgent = val
+	}
+	if val := getenv("SCRAPER_MAX_BODY_SIZE"); val != "" {
+		cfg.Scraper.MaxBodySize, err = strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_MAX_BODY_SIZE: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_MAX_REDIRECTS"); val != "" {
+		cfg.Scraper.MaxRedirects, err = strconv.Atoi(val)
+		if err != nil {
+			return config{}, fmt.Errorf("invalid SCRAPER_MAX_REDIRECTS: %w", err)
+		}
+	}
+	if val := getenv("SCRAPER_ALLOWED_HOSTS"); val != "" {
+		cfg.Scraper.AllowedHosts = splitList(val)
+	}
+	if val := getenv("CORS_ORIGINS"); val != "" {
+		cfg.CORSOrigins = splitList(val)
+	}
+	if val := getenv("LOG_LEVEL"); val != "" {
+		cfg.LogLevel = val
+	}
+
+	// command line flags that were set explicitly
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "database-url":
+			cfg.DatabaseURL = flagCfg.DatabaseURL
+		case "database-password-file":
+			cfg.DatabasePasswordFile = flagCfg.DatabasePasswordFile
+		case "listen-addr":
+			cfg.ListenAddr = flagCfg.ListenAddr
+		case "public-url":
+			cfg.PublicURL = flagCfg.PublicURL
+		case "trust-proxy-headers":
+			cfg.TrustProxyHeaders = flagCfg.TrustProxyHeaders
+		case "scraper-concurrency":
+			cfg.Scraper.Concurrency = flagCfg.Scraper.Concurrency
+		case "per-host-concurrency":
+			cfg.Scraper.PerHostConcurrency = flagCfg.Scraper.PerHostConcurrency
+		case "per-host-rate":
+			cfg.Scraper.PerHostRate = flagCfg.Scraper.PerHostRate
+		case "per-host-burst":
+			cfg.Scraper.PerHostBurst = flagCfg.Scraper.PerHostBurst
+		case "scraper-interval":
+			cfg.Scraper.Interval = flagCfg.Scraper.Interval
+		case "http-timeout":
+			cfg.Scraper.HTTPTimeout = flagCfg.Scraper.HTTPTimeout
+		case "lease-duration":
+			cfg.Scraper.LeaseDuration = flagCfg.Scraper.LeaseDuration
+		case "user-agent":
+			cfg.Scraper.UserAgent = flagCfg.Scraper.UserAgent
+		case "max-body-size":
+			cfg.Scraper.MaxBodySize = flagCfg.Scraper.MaxBodySize
+		case "max-redirects":
+			cfg.Scraper.MaxRedirects = flagCfg.Scraper.MaxRedirects
+		case "cors-origins":
+			cfg.CORSOrigins = splitList(corsOrigins)
+		case "allowed-hosts":
+			cfg.Scraper.AllowedHosts = splitList(allowedHosts)
+		case "log-level":
+			cfg.LogLevel = flagCfg.LogLevel
+		}
+	})
+
+	// links are appended to the public URL
+	cfg.PublicURL = strings.TrimRight(cfg.PublicURL, "/")
+	return cfg, cfg.validate()
+}
+
+func (cfg config) validate() error {
+	var errs []error
+	if cfg.DatabaseURL != "" {
+		dbURL, err := url.Parse(cfg.DatabaseURL)
+		if err != nil || (dbURL.Scheme != "postgres" && dbURL.Scheme != "postgresql") {
+			errs = append(errs, errors.New("database URL must be a postgres:// URL"))
+		}
+	} else if cfg.DatabasePasswordFile == "" {
+		errs = append(errs, errors.New("either a database URL or a database password file is required"))
+	}
+	if cfg.ListenAddr == "" {
+		errs = append(errs, errors.New("listen address is required"))
+	}
+	if cfg.PublicURL != "" {
+		publicURL, err := url.Parse(cfg.PublicURL)
+		if err != nil || (publicURL.Scheme != "http" && publicURL.Scheme != "https") || publicURL.Host == "" || publicURL.RawQuery != "" || publicURL.Fragment != "" {
+			errs = append(errs, errors.New("public URL must be an http:// or https:// URL without query or fragment"))
+		}
+	}
+	if cfg.Scraper.Concurrency < 1 {
+		errs = append(errs, errors.New("scraper concurrency must be at least 1"))
+	}
+	if cfg.Scraper.PerHostConcurrency < 1 {
+		errs = append(errs, errors.New("scraper per-host concurrency must be at least 1"))
+	}
+	if cfg.Scraper.PerHostRate <= 0 {
+		errs = append(errs, errors.New("scraper per-host rate must be positive"))
+	}
+	if cfg.Scraper.PerHostBurst < 1 {
+		errs = append(errs, errors.New("scraper per-host burst must be at least 1"))
+	}
+	for domain, limits := range cfg.Scraper.Hosts {
+		if limits.Concurrency < 0 || limits.Rate < 0 || limits.Burst < 0 {
+			errs = append(errs, fmt.Errorf("limits of host %s must not be negative", domain))
+		}
+	}
+	if cfg.Scraper.Interval < time.Second {
+		errs = append(errs, errors.New("scraper interval must be at least 1s"))
+	}
+	if cfg.Scraper.HTTPTimeout <= 0 {
+		errs = append(errs, errors.New("scraper HTTP timeout must be positive"))
+	}
+	// a lease must outlast the fetch of the feed
+	if cfg.Scraper.LeaseDuration <= cfg.Scraper.HTTPTimeout {
+		errs = append(errs, errors.New("scraper lease duration must be longer than the HTTP timeout"))
+	}
+	if strings.TrimSpace(cfg.Scraper.UserAgent) == "" {
+		errs = append(errs, errors.New("scraper User-Agent is required"))
+	}
+	if cfg.Scraper.MaxBodySize < 1 {
+		errs = append(errs, errors.New("scraper max body size must be positive"))
+	}
+	if cfg.Scraper.MaxRedirects < 0 {
+		errs = append(errs, errors.New("scraper max redirects must not be negative"))
+	}
+	if len(cfg.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("at least one CORS origin is required"))
+	}
+	if _, err := cfg.slogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// dsn returns the URL to connect to the database with
+func (cfg config) dsn() (string, error) {
+	if cfg.DatabaseURL != "" {
+		return cfg.DatabaseURL, nil
+	}
+	bin, err := os.ReadFile(cfg.DatabasePasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get DB password: %w", err)
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword("postgres", strings.TrimRight(string(bin), "\r\n")),
+		Host:     "db:5432",
+		Path:     "scraperss",
+		RawQuery: "sslmode=disable",
+	}
+	return dsn.String(), nil
+}
+
+func (cfg config) slogLevel() (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(cfg.LogLevel))
+	if err != nil {
+		return level, fmt.Errorf("log level must be one of debug, info, warn or error: %w", err)
+	}
+	return level, nil
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
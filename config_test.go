@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig(nil, func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("Failed to load default config: %v", err)
+	}
+	if cfg.ListenAddr != ":80" || cfg.Scraper.Concurrency != 10 || cfg.Scraper.Interval != time.Minute {
+		t.Errorf("Wrong defaults, got: %+v", cfg)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	// the file sets everything, env overrides some of it and flags override env
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(file, []byte(`
+database_url: postgres://file@localhost/scraperss
+listen_addr: ":8080"
+scraper:
+  concurrency: 4
+  interval: 5m
+  http_timeout: 20s
+  hosts:
+    example.com:
+      concurrency: 1
+      rate: 0.5
+cors_origins: ["https://file.example.com"]
+log_level: debug
+`), 0o600)
+	if err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	env := map[string]string{
+		"SCRAPERSS_CONFIG":    file,
+		"PUBLIC_URL":          "https://rss.example.com",
+		"TRUST_PROXY_HEADERS": "true",
+		"SCRAPER_CONCURRENCY": "8",
+		"CORS_ORIGINS":        "https://a.example.com, https://b.example.com",
+		"LISTEN_ADDR":         ":9090",
+	}
+	args := []string{"-listen-addr", ":7070", "-log-level", "warn"}
+
+	cfg, err := loadConfig(args, func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.DatabaseURL != "postgres://file@localhost/scraperss" {
+		t.Errorf("Wrong database URL, got: %v", cfg.DatabaseURL)
+	}
+	if cfg.Scraper.Interval != 5*time.Minute || cfg.Scraper.HTTPTimeout != 20*time.Second {
+		t.Errorf("Wrong durations from file, got: %+v", cfg.Scraper)
+	}
+	if got := cfg.Scraper.Hosts["example.com"]; got.Concurrency != 1 || got.Rate != 0.5 {
+		t.Errorf("Wrong host limits, got: %+v", cfg.Scraper.Hosts)
+	}
+	if cfg.Scraper.Concurrency != 8 {
+		t.Errorf("Wrong concurrency, got: %v want: 8", cfg.Scraper.Concurrency)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[1] != "https://b.example.com" {
+		t.Errorf("Wrong CORS origins, got: %v", cfg.CORSOrigins)
+	}
+	if cfg.PublicURL != "https://rss.example.com" || !cfg.TrustProxyHeaders {
+		t.Errorf("Wrong public URL settings, got: %v %v", cfg.PublicURL, cfg.TrustProxyHeaders)
+	}
+	if cfg.ListenAddr != ":7070" || cfg.LogLevel != "warn" {
+		t.Errorf("Flags didn't override, got: %v %v", cfg.ListenAddr, cfg.LogLevel)
+	}
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	invalid := []map[string]string{
+		{"DATABASE_URL": "mysql://localhost/db"},
+		{"SCRAPER_CONCURRENCY": "0"},
+		{"SCRAPER_CONCURRENCY": "many"},
+		{"SCRAPER_INTERVAL": "10ms"},
+		{"SCRAPER_LEASE_DURATION": "5s"},
+		{"SCRAPER_PER_HOST_CONCURRENCY": "0"},
+		{"SCRAPER_PER_HOST_RATE": "0"},
+		{"SCRAPER_PER_HOST_BURST": "0"},
+		{"SCRAPER_MAX_BODY_SIZE": "0"},
+		{"SCRAPER_MAX_REDIRECTS": "-1"},
+		{"LOG_LEVEL": "loud"},
+		{"PUBLIC_URL": "rss.example.com"},
+		{"PUBLIC_URL": "https://rss.example.com/?feed=1"},
+		{"TRUST_PROXY_HEADERS": "maybe"},
+	}
+	for _, env := range invalid {
+		_, err := loadConfig(nil, func(key string) string { return env[key] })
+		if err == nil {
+			t.Errorf("Expected an error for %v, got none", env)
+		}
+	}
+}
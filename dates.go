@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sources of the publication date recorded on posts
+const (
+	dateSourcePublished = "published"
+	dateSourceUpdated   = "updated"
+	dateSourceDCDate    = "dc:date"
+	dateSourceFirstSeen = "first_seen"
+)
+
+// layouts seen in the wild for RSS (RFC 822 and variants) and Atom/JSON Feed
+// (RFC 3339 and ISO 8601) dates. Days without a leading zero are matched by
+// the "2" in the layouts.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"Mon, 2 January 2006 15:04:05 -0700",
+	"Mon, 2 January 2006 15:04:05 MST",
+	"Monday, 2 Jan 2006 15:04:05 -0700",
+	"Monday, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 -0700 (MST)",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC850,
+	time.UnixDate,
+	time.ANSIC,
+}
+
+// UTC offsets of named timezones used in feeds. Go only knows the offsets of
+// UTC, GMT and the zone of the local machine, and silently treats any other
+// abbreviation as UTC. EST to PDT are the US zones defined by RFC 822, which
+// is why CST is US Central and not China Standard Time.
+var feedDateZones = map[string]int{
+	"UT":   0,
+	"UTC":  0,
+	"GMT":  0,
+	"Z":    0,
+	"EST":  -5 * 60 * 60,
+	"EDT":  -4 * 60 * 60,
+	"CST":  -6 * 60 * 60,
+	"CDT":  -5 * 60 * 60,
+	"MST":  -7 * 60 * 60,
+	"MDT":  -6 * 60 * 60,
+	"PST":  -8 * 60 * 60,
+	"PDT":  -7 * 60 * 60,
+	"AKST": -9 * 60 * 60,
+	"AKDT": -8 * 60 * 60,
+	"HST":  -10 * 60 * 60,
+	"WET":  0,
+	"WEST": 1 * 60 * 60,
+	"CET":  1 * 60 * 60,
+	"CEST": 2 * 60 * 60,
+	"EET":  2 * 60 * 60,
+	"EEST": 3 * 60 * 60,
+	"MSK":  3 * 60 * 60,
+	"JST":  9 * 60 * 60,
+	"KST":  9 * 60 * 60,
+	"AEST": 10 * 60 * 60,
+	"AEDT": 11 * 60 * 60,
+	"NZST": 12 * 60 * 60,
+	"NZDT": 13 * 60 * 60,
+}
+
+// abbreviations shared by several timezones, dates in them are rejected so
+// that the next date of the item is used instead of a guess
+var ambiguousDateZones = map[string]string{
+	"IST": "India, Irish or Israel Standard Time",
+	"BST": "British Summer Time or Bangladesh Standard Time",
+}
+
+// parseFeedDate parses a date found in a feed and returns it in UTC
+func parseFeedDate(date string) (time.Time, error) {
+	// collapse whitespace, some feeds wrap or pad their dates
+	date = strings.Join(strings.Fields(date), " ")
+	if date == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	// Go can't parse RFC 822's "UT" zone
+	if strings.HasSuffix(date, " UT") {
+		date += "C"
+	}
+
+	for _, layout := range feedDateLayouts {
+		t, err := time.Parse(layout, date)
+		if err != nil {
+			continue
+		}
+		// resolve named timezones Go doesn't know the offset of
+		zone, offset := t.Zone()
+		if zones, ok := ambiguousDateZones[zone]; ok {
+			return time.Time{}, fmt.Errorf("ambiguous timezone %s (%s) in date %q", zone, zones, date)
+		}
+		if knownOffset, ok := feedDateZones[zone]; ok && offset != knownOffset {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(),
+				time.FixedZone(zone, knownOffset))
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date format %q", date)
+}
+
+// resolvePublishedAt picks the publication date of a feed item. The item's
+// own publication date is preferred, then its update date, then dc:date.
+// Items without any usable date are dated to when they were first seen.
+func resolvePublishedAt(item RSSItem, firstSeen time.Time) (time.Time, string) {
+	candidates := []struct {
+		source string
+		date   string
+	}{
+		{dateSourcePublished, item.PubDate},
+		{dateSourceUpdated, item.Updated},
+		{dateSourceDCDate, item.DCDate},
+	}
+	for _, candidate := range candidates {
+		if strings.TrimSpace(candidate.date) == "" {
+			continue
+		}
+		t, err := parseFeedDate(candidate.date)
+		if err != nil {
+			continue
+		}
+		return t, candidate.source
+	}
+	return firstSeen.UTC(), dateSourceFirstSeen
+}
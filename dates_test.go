@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFeedDate(t *testing.T) {
+	want := time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)
+	dates := []string{
+		"Tue, 02 Jan 2024 15:04:05 GMT",
+		"Tue, 02 Jan 2024 15:04:05 UT",
+		"Tue, 02 Jan 2024 17:04:05 +0200",
+		"Tue, 2 Jan 2024 15:04:05 GMT",
+		"Tue, 2 Jan 2024 10:04:05 EST",
+		"Tue, 2 Jan 2024 07:04:05 PST",
+		"Tue, 2 Jan 2024 16:04:05 CET",
+		"Tue,  2 Jan 2024 15:04:05  GMT ",
+		"2 Jan 2024 15:04:05 +0000",
+		"Tue, 2 January 2024 15:04:05 +0000",
+		"Tuesday, 2 Jan 2024 15:04:05 GMT",
+		"2024-01-02T15:04:05Z",
+		"2024-01-02T17:04:05+02:00",
+		"2024-01-02T17:04:05+0200",
+		"2024-01-02T15:04:05.000Z",
+		"2024-01-02T15:04:05",
+		"2024-01-02 15:04:05",
+	}
+	for _, date := range dates {
+		got, err := parseFeedDate(date)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", date, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("Wrong date for %q, got: %v want: %v", date, got, want)
+		}
+	}
+
+	// dates without a time are midnight UTC
+	got, err := parseFeedDate("2024-01-02")
+	if err != nil {
+		t.Fatalf("Failed to parse date only: %v", err)
+	}
+	if !got.Equal(time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong date for date only, got: %v", got)
+	}
+
+	for _, date := range []string{"", "   ", "yesterday", "02/01/2024", "Tue, 2 Jan 2024 20:34:05 IST", "Tue, 2 Jan 2024 16:04:05 BST"} {
+		if _, err := parseFeedDate(date); err == nil {
+			t.Errorf("Expected an error for %q, got none", date)
+		}
+	}
+}
+
+func TestResolvePublishedAt(t *testing.T) {
+	firstSeen := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		item       RSSItem
+		wantTime   time.Time
+		wantSource string
+	}{
+		{
+			name:       "pubDate",
+			item:       RSSItem{PubDate: "Tue, 02 Jan 2024 15:04:05 GMT", Updated: "2024-01-05T00:00:00Z"},
+			wantTime:   time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC),
+			wantSource: dateSourcePublished,
+		},
+		{
+			name:       "unparseable pubDate falls back to updated",
+			item:       RSSItem{PubDate: "sometime", Updated: "2024-01-05T00:00:00Z"},
+			wantTime:   time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC),
+			wantSource: dateSourceUpdated,
+		},
+		{
+			name:       "pubDate in an ambiguous timezone falls back to dc:date",
+			item:       RSSItem{PubDate: "Tue, 02 Jan 2024 20:34:05 IST", DCDate: "2024-01-02T15:04:05Z"},
+			wantTime:   time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC),
+			wantSource: dateSourceDCDate,
+		},
+		{
+			name:       "dc:date",
+			item:       RSSItem{DCDate: "2024-01-03T08:00:00Z"},
+			wantTime:   time.Date(2024, time.January, 3, 8, 0, 0, 0, time.UTC),
+			wantSource: dateSourceDCDate,
+		},
+		{
+			name:       "no dates",
+			item:       RSSItem{Title: "Undated"},
+			wantTime:   firstSeen,
+			wantSource: dateSourceFirstSeen,
+		},
+	}
+	for _, tc := range tests {
+		gotTime, gotSource := resolvePublishedAt(tc.item, firstSeen)
+		if !gotTime.Equal(tc.wantTime) || gotSource != tc.wantSource {
+			t.Errorf("%s: got: %v (%s) want: %v (%s)", tc.name, gotTime, gotSource, tc.wantTime, tc.wantSource)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// prefixes of the item keys identifying posts within a feed
+const (
+	itemKeyGUID = "guid:"
+	itemKeyLink = "link:"
+	itemKeyHash = "hash:"
+)
+
+// query parameters added to links for tracking, which don't change what
+// the link points to
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"igshid":  true,
+	"yclid":   true,
+}
+
+// postItemKey returns the key identifying an item within its feed. Items are
+// identified by their GUID, then by their canonical link, and items with
+// neither by a hash of their content.
+func postItemKey(item RSSItem) string {
+	if guid := strings.TrimSpace(item.GUID.Value); guid != "" {
+		// permalinks are links too, and may change scheme or gain tracking
+		// parameters just the same
+		if item.GUID.PermaLink() {
+			if link, err := canonicalizeLink(guid); err == nil {
+				return itemKeyGUID + link
+			}
+		}
+		return itemKeyGUID + guid
+	}
+	if link, err := canonicalizeLink(item.Link); err == nil {
+		return itemKeyLink + link
+	}
+	return itemKeyHash + postContentHash(item)
+}
+
+// canonicalizeLink normalizes a link so that variants of the same URL compare
+// equal: http and https, upper case hosts, default ports, fragments, tracking
+// parameters and the order of query parameters are ignored
+func canonicalizeLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", errors.New("empty link")
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if (scheme != "http" && scheme != "https") || u.Host == "" {
+		return "", errors.New("not an absolute http(s) link")
+	}
+	u.Scheme = "https"
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	query := u.Query()
+	for name := range query {
+		if trackingParams[strings.ToLower(name)] || strings.HasPrefix(strings.ToLower(name), "utm_") {
+			query.Del(name)
+		}
+	}
+	// Encode sorts the parameters by name
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// postContentHash returns a hash of the content of an item, used to find out
+// whether an item was edited since it was last seen
+func postContentHash(item RSSItem) string {
+	categories := append([]string{}, item.Categories...)
+	sort.Strings(categories)
+	enclosures := []string{}
+	for _, enclosure := range item.Enclosures {
+		enclosures = append(enclosures, enclosure.URL)
+	}
+	sort.Strings(enclosures)
+
+	fields := []string{
+		item.Title,
+		item.Link,
+		item.Description,
+		item.Content,
+		item.ItemAuthor(),
+		strings.Join(categories, "\x1f"),
+		item.Comments,
+		strings.Join(enclosures, "\x1f"),
+	}
+	hash := sha256.New()
+	for _, field := range fields {
+		hash.Write([]byte(strings.TrimSpace(field)))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
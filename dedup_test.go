@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestCanonicalizeLink(t *testing.T) {
+	want := "https://example.com/posts/1?a=1&b=2"
+	links := []string{
+		"https://example.com/posts/1?a=1&b=2",
+		"http://example.com/posts/1?a=1&b=2",
+		"https://EXAMPLE.com:443/posts/1?b=2&a=1",
+		"https://example.com/posts/1?a=1&b=2#comments",
+		"https://example.com/posts/1?utm_source=rss&a=1&utm_medium=feed&b=2&fbclid=abc",
+		"  https://example.com/posts/1?a=1&b=2\n",
+	}
+	for _, link := range links {
+		got, err := canonicalizeLink(link)
+		if err != nil {
+			t.Errorf("Failed to canonicalize %q: %v", link, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Wrong canonical link for %q, got: %v want: %v", link, got, want)
+		}
+	}
+
+	if got, _ := canonicalizeLink("https://example.com"); got != "https://example.com/" {
+		t.Errorf("Wrong canonical link for bare host, got: %v", got)
+	}
+	if got, _ := canonicalizeLink("https://example.com:8443/a"); got != "https://example.com:8443/a" {
+		t.Errorf("Non-default port must be kept, got: %v", got)
+	}
+	for _, link := range []string{"", "/posts/1", "mailto:jane@example.com", "://broken"} {
+		if _, err := canonicalizeLink(link); err == nil {
+			t.Errorf("Expected an error for %q, got none", link)
+		}
+	}
+}
+
+func TestPostItemKey(t *testing.T) {
+	tests := []struct {
+		name string
+		item RSSItem
+		want string
+	}{
+		{
+			name: "guid",
+			item: RSSItem{GUID: RSSGUID{Value: "post-1", IsPermaLink: "false"}, Link: "https://example.com/1"},
+			want: "guid:post-1",
+		},
+		{
+			name: "permalink guid is canonicalized",
+			item: RSSItem{GUID: RSSGUID{Value: "http://example.com/1?utm_source=rss"}},
+			want: "guid:https://example.com/1",
+		},
+		{
+			name: "link without guid",
+			item: RSSItem{Link: "http://Example.com/1#top"},
+			want: "link:https://example.com/1",
+		},
+	}
+	for _, tc := range tests {
+		if got := postItemKey(tc.item); got != tc.want {
+			t.Errorf("%s: got: %v want: %v", tc.name, got, tc.want)
+		}
+	}
+
+	// items with neither are identified by their content
+	item := RSSItem{Title: "No link", Description: "Only text"}
+	if got, want := postItemKey(item), "hash:"+postContentHash(item); got != want {
+		t.Errorf("Wrong key for item without GUID and link, got: %v want: %v", got, want)
+	}
+}
+
+func TestPostContentHash(t *testing.T) {
+	item := RSSItem{Title: "Post", Content: "Hello", Categories: []string{"a", "b"}}
+	hash := postContentHash(item)
+
+	reordered := item
+	reordered.Categories = []string{"b", "a"}
+	if postContentHash(reordered) != hash {
+		t.Errorf("Order of categories must not change the content hash")
+	}
+
+	edited := item
+	edited.Content = "Hello, edited"
+	if postContentHash(edited) == hash {
+		t.Errorf("Edited content must change the content hash")
+	}
+}
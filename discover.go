@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// media types of the feeds linked from web pages
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// paths where sites commonly serve their feeds, probed if a page links
+// no feeds
+var commonFeedPaths = []string{"/feed", "/rss", "/feed.xml", "/rss.xml", "/atom.xml", "/index.xml", "/feed.json"}
+
+// discovery runs while the client waits for the response, the page and all
+// the requests made for it share this deadline
+const discoveryTimeout = 3 * time.Second
+
+// discoverFeeds returns the feeds found at a URL. A feed URL is its own only
+// candidate. For a web page, the feeds it links with <link rel="alternate">
+// are returned, or else the feeds found at the common feed paths of its site.
+// It gives up after discoveryTimeout.
+func (f *feedFetcher) discoverFeeds(ctx context.Context, pageURL string) ([]FeedCandidate, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	header := http.Header{}
+	header.Set("Accept", "text/html, application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8")
+	resp, err := f.get(ctx, pageURL, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetchError{Kind: fetchErrorStatus, Err: &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+	dat, err := f.readBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if rssFeed, err := parseFeed(contentType, dat); err == nil {
+		feedURL := pageURL
+		if permanentURL := permanentRedirectURL(resp); permanentURL != "" {
+			feedURL = permanentURL
+		}
+		return []FeedCandidate{{Url: feedURL, Title: strings.TrimSpace(rssFeed.Channel.Title)}}, nil
+	}
+	// relative links are resolved against the URL the page was served from
+	base := resp.Request.URL
+	if isHTML(contentType, dat) {
+		candidates, err := htmlFeedLinks(base, contentType, dat)
+		if err != nil {
+			return nil, &fetchError{Kind: fetchErrorParse, Err: err}
+		}
+		if len(candidates) > 0 {
+			return f.allowedCandidates(ctx, candidates), nil
+		}
+	}
+	candidates := f.probeFeedPaths(ctx, base)
+	// probes cut short by the deadline don't tell that the site has no feeds
+	if len(candidates) == 0 && ctx.Err() != nil {
+		return nil, &fetchError{Kind: fetchErrorNetwork, Err: ctx.Err()}
+	}
+	return candidates, nil
+}
+
+// allowedCandidates drops the linked feeds that users may not follow, as
+// pages may link into private networks
+func (f *feedFetcher) allowedCandidates(ctx context.Context, candidates []FeedCandidate) []FeedCandidate {
+	allowed := []FeedCandidate{}
+	for _, candidate := range candidates {
+		if f.checkURL(ctx, candidate.Url) == nil {
+			allowed = append(allowed, candidate)
+		}
+	}
+	return allowed
+}
+
+// probeFeedPaths returns the feeds found at the common feed paths of a site
+func (f *feedFetcher) probeFeedPaths(ctx context.Context, site *url.URL) []FeedCandidate {
+	found := make([]*FeedCandidate, len(commonFeedPaths))
+	wg := sync.WaitGroup{}
+	for i, path := range commonFeedPaths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probeURL := (&url.URL{Scheme: site.Scheme, Host: site.Host, Path: path}).String()
+			fetched, err := f.fetchFeed(ctx, probeURL, feedCacheState{})
+			if err != nil {
+				return
+			}
+			// sites often serve the same feed at several paths
+			feedURL := probeURL
+			if fetched.PermanentURL != "" {
+				feedURL = fetched.PermanentURL
+			}
+			found[i] = &FeedCandidate{Url: feedURL, Title: strings.TrimSpace(fetched.Feed.Channel.Title)}
+		}()
+	}
+	wg.Wait()
+
+	candidates := []FeedCandidate{}
+	seen := map[string]bool{}
+	for _, candidate := range found {
+		if candidate == nil || seen[candidate.Url] {
+			continue
+		}
+		seen[candidate.Url] = true
+		candidates = append(candidates, *candidate)
+	}
+	return candidates
+}
+
+// isHTML reports whether a document is a web page, by its Content-Type or
+// else by sniffing
+func isHTML(contentType string, dat []byte) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil && mediaType != "text/plain" && mediaType != "application/octet-stream" {
+		return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	}
+	return strings.HasPrefix(http.DetectContentType(dat), "text/html")
+}
+
+// htmlFeedLinks returns the feeds linked from the <head> of a web page, with
+// <link rel="alternate"> elements of a feed type, titled by their title or
+// else by the title of the page
+func htmlFeedLinks(base *url.URL, contentType string, dat []byte) ([]FeedCandidate, error) {
+	reader, err := charset.NewReader(bytes.NewReader(dat), contentType)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode the page: %w", err)
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the page: %w", err)
+	}
+
+	pageTitle := ""
+	candidates := []FeedCandidate{}
+	seen := map[string]bool{}
+	var visit func(node *html.Node)
+	visit = func(node *html.Node) {
+		if node.Type == html.ElementNode {
+			switch node.Data {
+			case "body":
+				// feeds are only linked from the head
+				return
+			case "title":
+				if node.FirstChild != nil && pageTitle == "" {
+					pageTitle = strings.TrimSpace(node.FirstChild.Data)
+				}
+			case "base":
+				if href, err := url.Parse(htmlAttr(node, "href")); err == nil && htmlAttr(node, "href") != "" {
+					base = base.ResolveReference(href)
+				}
+			case "link":
+				if !hasToken(htmlAttr(node, "rel"), "alternate") {
+					break
+				}
+				mediaType, _, err := mime.ParseMediaType(htmlAttr(node, "type"))
+				if err != nil || !feedLinkTypes[strings.ToLower(mediaType)] {
+					break
+				}
+				href, err := url.Parse(strings.TrimSpace(htmlAttr(node, "href")))
+				if err != nil || htmlAttr(node, "href") == "" {
+					break
+				}
+				feedURL := base.ResolveReference(href).String()
+				if !seen[feedURL] {
+					seen[feedURL] = true
+					candidates = append(candidates, FeedCandidate{Url: feedURL, Title: strings.TrimSpace(htmlAttr(node, "title"))})
+				}
+			}
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			visit(child)
+		}
+	}
+	visit(doc)
+
+	for i := range candidates {
+		if candidates[i].Title == "" {
+			candidates[i].Title = pageTitle
+		}
+	}
+	return candidates, nil
+}
+
+// htmlAttr returns the value of an attribute of an element, or ""
+func htmlAttr(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether a space-separated list, like the rel attribute,
+// contains a token
+func hasToken(list string, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
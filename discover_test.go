@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDiscoverFeeds(t *testing.T) {
+	dat := readFixture(t, "rss2.xml")
+	serveFeed := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(dat)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blog/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<!DOCTYPE html><html><head>
+<title>Example Blog</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts" href="posts.xml">
+<link rel="alternate" type="application/atom+xml" href="https://93.184.216.34/atom">
+<link rel="alternate" type="text/html" hreflang="de" href="/de/blog/">
+<link rel="alternate" type="application/rss+xml" href="http://127.0.0.2/internal.xml">
+</head><body><link rel="alternate" type="application/rss+xml" href="/body.xml"></body></html>`))
+	})
+	mux.HandleFunc("/blog/posts.xml", serveFeed)
+	mux.HandleFunc("/plain/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>No links</title></head><body></body></html>"))
+	})
+	mux.HandleFunc("/feed", serveFeed)
+	mux.HandleFunc("/rss", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed", http.StatusMovedPermanently)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	fetcher := newFeedFetcher(testScraperConfig())
+
+	tests := map[string][]FeedCandidate{
+		// a feed is its own candidate
+		"/feed": {{Url: srv.URL + "/feed", Title: "Example RSS Blog"}},
+		// feeds linked from the head of a page, except those in private networks
+		"/blog/": {
+			{Url: srv.URL + "/blog/posts.xml", Title: "Posts"},
+			{Url: "https://93.184.216.34/atom", Title: "Example Blog"},
+		},
+		// the common paths of the site are probed for pages without links
+		"/plain/": {{Url: srv.URL + "/feed", Title: "Example RSS Blog"}},
+	}
+	for path, want := range tests {
+		candidates, err := fetcher.discoverFeeds(context.Background(), srv.URL+path)
+		if err != nil {
+			t.Fatalf("Failed to discover feeds of %v: %v", path, err)
+		}
+		if !reflect.DeepEqual(candidates, want) {
+			t.Errorf("Wrong candidates of %v, got: %+v want: %+v", path, candidates, want)
+		}
+	}
+
+	_, err := fetcher.discoverFeeds(context.Background(), srv.URL+"/missing")
+	if got := fetchErrorKind(err); got != fetchErrorStatus {
+		t.Errorf("Wrong kind of error for a missing page, got: %q want: %q (%v)", got, fetchErrorStatus, err)
+	}
+}
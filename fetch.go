@@ -0,0 +1,288 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// kinds of errors a fetch of a feed fails with
+const (
+	fetchErrorNetwork  = "network"
+	fetchErrorStatus   = "status"
+	fetchErrorParse    = "parse"
+	fetchErrorTooLarge = "too_large"
+	fetchErrorBlocked  = "blocked"
+)
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+// number of failed fetches by kind of error
+var fetchErrors = expvar.NewMap("scraper_fetch_errors")
+
+// fetchError is returned by fetches of feeds, classifying the error so that
+// failures can be told apart in logs and metrics
+type fetchError struct {
+	Kind string
+	Err  error
+}
+
+func (e *fetchError) Error() string {
+	return fmt.Sprintf("%s error: %v", e.Kind, e.Err)
+}
+
+func (e *fetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchErrorKind returns the kind of a fetch error, or "" if the error
+// didn't come from a fetch
+func fetchErrorKind(err error) string {
+	var fetchErr *fetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Kind
+	}
+	return ""
+}
+
+// httpStatusError is returned when a feed is answered with an unexpected
+// status code
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	// set from the Retry-After header of 429 and 503 responses
+	RetryAfter time.Time
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected response status %s", e.Status)
+}
+
+// feedCacheState holds the validators of the last successful fetch of
+// a feed, used to make conditional requests
+type feedCacheState struct {
+	ETag         string
+	LastModified string
+	ContentHash  string
+}
+
+type fetchedFeed struct {
+	Feed RSSFeed
+	// NotModified is set if the feed didn't change since the last fetch,
+	// Feed is empty in that case
+	NotModified bool
+	Cache       feedCacheState
+	// max-age of the response from its Cache-Control header
+	MaxAge time.Duration
+	// PermanentURL is set if the feed was moved to another URL with
+	// permanent redirects
+	PermanentURL string
+}
+
+// feedFetcher downloads feed documents. A single fetcher, and with it a
+// single pool of connections, is shared by all scrapes.
+type feedFetcher struct {
+	client      *http.Client
+	guard       *urlGuard
+	userAgent   string
+	maxBodySize int64
+}
+
+func newFeedFetcher(cfg scraperConfig) *feedFetcher {
+	guard := newURLGuard(cfg.AllowedHosts)
+	// connections to the internal network are refused, whatever the URL
+	transport := guard.transport()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = cfg.PerHostConcurrency
+	transport.ResponseHeaderTimeout = cfg.HTTPTimeout
+	// responses are decompressed by the fetcher, which also understands brotli
+	transport.DisableCompression = true
+
+	return &feedFetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.HTTPTimeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > cfg.MaxRedirects {
+					return fmt.Errorf("%w, stopped after %d", errTooManyRedirects, cfg.MaxRedirects)
+				}
+				return nil
+			},
+		},
+		guard:       guard,
+		userAgent:   cfg.UserAgent,
+		maxBodySize: cfg.MaxBodySize,
+	}
+}
+
+// fetch downloads and parses a feed, unless it didn't change since the fetch
+// the cache state is from
+func (f *feedFetcher) fetch(ctx context.Context, url string, cache feedCacheState) (fetchedFeed, error) {
+	fetched, err := f.fetchFeed(ctx, url, cache)
+	if err != nil {
+		if kind := fetchErrorKind(err); kind != "" {
+			fetchErrors.Add(kind, 1)
+		}
+		return fetchedFeed{}, err
+	}
+	return fetched, nil
+}
+
+func (f *feedFetcher) fetchFeed(ctx context.Context, url string, cache feedCacheState) (fetchedFeed, error) {
+	header := http.Header{}
+	// only download the feed if it changed since the last fetch
+	if cache.ETag != "" {
+		header.Set("If-None-Match", cache.ETag)
+	}
+	if cache.LastModified != "" {
+		header.Set("If-Modified-Since", cache.LastModified)
+	}
+	resp, err := f.get(ctx, url, header)
+	if err != nil {
+		return fetchedFeed{}, err
+	}
+	defer resp.Body.Close()
+
+	maxAge := cacheMaxAge(resp.Header)
+	permanentURL := permanentRedirectURL(resp)
+	if resp.StatusCode == http.StatusNotModified {
+		return fetchedFeed{NotModified: true, Cache: updatedCacheState(cache, resp, cache.ContentHash), MaxAge: maxAge, PermanentURL: permanentURL}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return fetchedFeed{}, &fetchError{Kind: fetchErrorStatus, Err: statusErr}
+	}
+
+	dat, err := f.readBody(resp)
+	if err != nil {
+		return fetchedFeed{}, err
+	}
+
+	// servers without validators may still send the same document
+	hash := sha256.Sum256(dat)
+	contentHash := hex.EncodeToString(hash[:])
+	newCache := updatedCacheState(cache, resp, contentHash)
+	if contentHash == cache.ContentHash {
+		return fetchedFeed{NotModified: true, Cache: newCache, MaxAge: maxAge, PermanentURL: permanentURL}, nil
+	}
+
+	rssFeed, err := parseFeed(resp.Header.Get("Content-Type"), dat)
+	if err != nil {
+		return fetchedFeed{}, &fetchError{Kind: fetchErrorParse, Err: err}
+	}
+	return fetchedFeed{Feed: rssFeed, Cache: newCache, MaxAge: maxAge, PermanentURL: permanentURL}, nil
+}
+
+// permanentRedirectURL returns the URL a response was moved to by the
+// permanent redirects (301 and 308) at the start of its redirect chain, or ""
+// if the first redirect wasn't permanent. A temporary redirect ends the chain
+// of permanent ones, as its target may change any time.
+func permanentRedirectURL(resp *http.Response) string {
+	// the redirect chain is linked backwards from the last request
+	var chain []*http.Request
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		chain = append(chain, req)
+	}
+	permanentURL := ""
+	for i := len(chain) - 1; i >= 0; i-- {
+		status := chain[i].Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			break
+		}
+		permanentURL = chain[i].URL.String()
+	}
+	return permanentURL
+}
+
+// get sends a GET request with the headers of the fetcher, which the given
+// headers are added to
+func (f *feedFetcher) get(ctx context.Context, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, text/xml;q=0.9, */*;q=0.8")
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		// redirect loops are the server's answer, not a network failure
+		if errors.Is(err, errTooManyRedirects) {
+			return nil, &fetchError{Kind: fetchErrorStatus, Err: err}
+		}
+		if errors.Is(err, errUnsafeAddress) {
+			return nil, &fetchError{Kind: fetchErrorBlocked, Err: err}
+		}
+		return nil, &fetchError{Kind: fetchErrorNetwork, Err: err}
+	}
+	return resp, nil
+}
+
+// readBody reads the decompressed body of a response, failing once it
+// exceeds the max body size, so that neither huge documents nor compression
+// bombs are read into memory
+func (f *feedFetcher) readBody(resp *http.Response) ([]byte, error) {
+	tooLarge := &fetchError{Kind: fetchErrorTooLarge, Err: fmt.Errorf("feed is larger than %d bytes", f.maxBodySize)}
+	if resp.ContentLength > f.maxBodySize {
+		return nil, tooLarge
+	}
+
+	var body io.Reader = resp.Body
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+	case "gzip", "x-gzip":
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, &fetchError{Kind: fetchErrorParse, Err: fmt.Errorf("invalid gzip body: %w", err)}
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	case "br":
+		body = brotli.NewReader(resp.Body)
+	default:
+		return nil, &fetchError{Kind: fetchErrorParse, Err: fmt.Errorf("unsupported content encoding %q", encoding)}
+	}
+
+	dat, err := io.ReadAll(io.LimitReader(body, f.maxBodySize+1))
+	if err != nil {
+		return nil, &fetchError{Kind: fetchErrorNetwork, Err: err}
+	}
+	if int64(len(dat)) > f.maxBodySize {
+		return nil, tooLarge
+	}
+	return dat, nil
+}
+
+// checkURL checks that a URL given by a user may be fetched, see urlGuard
+func (f *feedFetcher) checkURL(ctx context.Context, rawURL string) error {
+	return f.guard.checkURL(ctx, rawURL)
+}
+
+// updatedCacheState keeps the previous validators unless the server sent new ones
+func updatedCacheState(cache feedCacheState, resp *http.Response, contentHash string) feedCacheState {
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		cache.ETag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		cache.LastModified = lastModified
+	}
+	cache.ContentHash = contentHash
+	return cache
+}
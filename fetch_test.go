@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// testScraperConfig allows fetching feeds from the local test servers
+func testScraperConfig() scraperConfig {
+	cfg := defaultConfig().Scraper
+	cfg.AllowedHosts = []string{"127.0.0.1"}
+	return cfg
+}
+
+func TestFetchFeedConditional(t *testing.T) {
+	dat := readFixture(t, "rss2.xml")
+	requests := 0
+	// test server that only sends the feed if the client's ETag is stale
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Tue, 02 Jan 2024 10:00:00 GMT")
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(dat)
+	}))
+	defer srv.Close()
+	fetcher := newFeedFetcher(testScraperConfig())
+
+	// the first fetch downloads the feed and returns its validators
+	fetched, err := fetcher.fetch(context.Background(), srv.URL, feedCacheState{})
+	if err != nil {
+		t.Fatalf("Failed to fetch feed: %v", err)
+	}
+	if fetched.NotModified || len(fetched.Feed.Channel.Item) != 2 {
+		t.Fatalf("Expected a full feed on the first fetch, got: %+v", fetched)
+	}
+	if fetched.Cache.ETag != `"v1"` || fetched.Cache.LastModified == "" || fetched.Cache.ContentHash == "" {
+		t.Errorf("Missing cache state after the first fetch, got: %+v", fetched.Cache)
+	}
+
+	// the second fetch is answered with 304 Not Modified
+	second, err := fetcher.fetch(context.Background(), srv.URL, fetched.Cache)
+	if err != nil {
+		t.Fatalf("Failed to fetch feed: %v", err)
+	}
+	if !second.NotModified {
+		t.Errorf("Expected feed to be not modified, got: %+v", second)
+	}
+	if second.Cache != fetched.Cache {
+		t.Errorf("Cache state changed on 304, got: %+v want: %+v", second.Cache, fetched.Cache)
+	}
+
+	// without validators, an unchanged document is detected by its hash
+	third, err := fetcher.fetch(context.Background(), srv.URL, feedCacheState{ContentHash: fetched.Cache.ContentHash})
+	if err != nil {
+		t.Fatalf("Failed to fetch feed: %v", err)
+	}
+	if !third.NotModified {
+		t.Errorf("Expected unchanged content to be not modified, got: %+v", third)
+	}
+	if requests != 3 {
+		t.Errorf("Wrong number of requests, got: %v want: 3", requests)
+	}
+}
+
+func TestFetchFeedCompression(t *testing.T) {
+	dat := readFixture(t, "rss2.xml")
+	var gzipped, brotlied bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	gzipWriter.Write(dat)
+	gzipWriter.Close()
+	brotliWriter := brotli.NewWriter(&brotlied)
+	brotliWriter.Write(dat)
+	brotliWriter.Close()
+
+	cfg := testScraperConfig()
+	cfg.UserAgent = "test-agent/1.0"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != cfg.UserAgent {
+			t.Errorf("Wrong User-Agent, got: %v want: %v", r.Header.Get("User-Agent"), cfg.UserAgent)
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		switch r.URL.Path {
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped.Bytes())
+		case "/br":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write(brotlied.Bytes())
+		default:
+			w.Write(dat)
+		}
+	}))
+	defer srv.Close()
+	fetcher := newFeedFetcher(cfg)
+
+	for _, path := range []string{"/plain", "/gzip", "/br"} {
+		fetched, err := fetcher.fetch(context.Background(), srv.URL+path, feedCacheState{})
+		if err != nil {
+			t.Fatalf("Failed to fetch %v feed: %v", path, err)
+		}
+		if len(fetched.Feed.Channel.Item) != 2 {
+			t.Errorf("Wrong number of items of %v feed, got: %v want: 2", path, len(fetched.Feed.Channel.Item))
+		}
+	}
+}
+
+func TestFetchFeedErrors(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<html><body>Not found</body></html>"))
+	})
+	mux.HandleFunc("/html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>Not a feed</body></html>"))
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("a"), 2048))
+	})
+	mux.HandleFunc("/bomb", func(w http.ResponseWriter, r *http.Request) {
+		// small on the wire, large once decompressed
+		w.Header().Set("Content-Encoding", "gzip")
+		gzipWriter := gzip.NewWriter(w)
+		gzipWriter.Write([]byte(strings.Repeat(" ", 1<<20)))
+		gzipWriter.Close()
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := testScraperConfig()
+	cfg.MaxBodySize = 1024
+	fetcher := newFeedFetcher(cfg)
+
+	tests := map[string]string{
+		"/missing": fetchErrorStatus,
+		"/html":    fetchErrorParse,
+		"/large":   fetchErrorTooLarge,
+		"/bomb":    fetchErrorTooLarge,
+		"/loop":    fetchErrorStatus,
+	}
+	for path, wantKind := range tests {
+		_, err := fetcher.fetch(context.Background(), srv.URL+path, feedCacheState{})
+		if got := fetchErrorKind(err); got != wantKind {
+			t.Errorf("Wrong kind of error for %v, got: %q want: %q (%v)", path, got, wantKind, err)
+		}
+	}
+
+	// the status of the response is kept for scheduling retries
+	_, err := fetcher.fetch(context.Background(), srv.URL+"/missing", feedCacheState{})
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 status error, got: %v", err)
+	}
+
+	// nothing listens anymore once the server is closed
+	srv.Close()
+	_, err = fetcher.fetch(context.Background(), srv.URL+"/html", feedCacheState{})
+	if got := fetchErrorKind(err); got != fetchErrorNetwork {
+		t.Errorf("Wrong kind of error for a closed server, got: %q want: %q (%v)", got, fetchErrorNetwork, err)
+	}
+}
+
+func TestFetchFeedPermanentRedirects(t *testing.T) {
+	dat := readFixture(t, "rss2.xml")
+	mux := http.NewServeMux()
+	redirect := func(target string, status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target, status)
+		}
+	}
+	mux.HandleFunc("/moved", redirect("/moved-again", http.StatusMovedPermanently))
+	mux.HandleFunc("/moved-again", redirect("/temporary", http.StatusPermanentRedirect))
+	mux.HandleFunc("/temporary", redirect("/feed", http.StatusFound))
+	mux.HandleFunc("/elsewhere", redirect("/moved", http.StatusTemporaryRedirect))
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(dat)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	fetcher := newFeedFetcher(testScraperConfig())
+
+	tests := map[string]string{
+		// permanent redirects are followed up to the first temporary one
+		"/moved": srv.URL + "/temporary",
+		// a feed behind a temporary redirect keeps its URL
+		"/elsewhere": "",
+		"/feed":      "",
+	}
+	for path, want := range tests {
+		fetched, err := fetcher.fetch(context.Background(), srv.URL+path, feedCacheState{})
+		if err != nil {
+			t.Fatalf("Failed to fetch %v: %v", path, err)
+		}
+		if fetched.PermanentURL != want {
+			t.Errorf("Wrong permanent URL of %v, got: %q want: %q", path, fetched.PermanentURL, want)
+		}
+	}
+}
+
+func TestFetchFeedBlockedAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request to reach the local server")
+	}))
+	defer srv.Close()
+
+	// the connection is refused by the dialer, even for URLs nobody checked
+	fetcher := newFeedFetcher(defaultConfig().Scraper)
+	_, err := fetcher.fetch(context.Background(), srv.URL, feedCacheState{})
+	if got := fetchErrorKind(err); got != fetchErrorBlocked {
+		t.Errorf("Wrong kind of error, got: %q want: %q (%v)", got, fetchErrorBlocked, err)
+	}
+}
+
+func TestFetchFeedBlockedBehindProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no request to go through the proxy, got: %v", r.URL)
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+
+	// the guard has to see the address of the feed, not the one of the proxy,
+	// which is allowed here like a proxy of the internal network would be
+	fetcher := newFeedFetcher(testScraperConfig())
+	if fetcher.client.Transport.(*http.Transport).Proxy != nil {
+		t.Errorf("Expected the fetcher to ignore proxies")
+	}
+	_, err := fetcher.fetch(context.Background(), "http://169.254.169.254/latest/meta-data/", feedCacheState{})
+	if got := fetchErrorKind(err); got != fetchErrorBlocked {
+		t.Errorf("Wrong kind of error, got: %q want: %q (%v)", got, fetchErrorBlocked, err)
+	}
+
+	sender := newWebhookSender(nil, newURLGuard([]string{"127.0.0.1"}), "scraperss-test")
+	if sender.client.Transport.(*http.Transport).Proxy != nil {
+		t.Errorf("Expected the webhook sender to ignore proxies")
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -21,45 +24,174 @@ func (apiCfg *apiConfig) handlerCreateFeed(w http.ResponseWriter, r *http.Reques
 	err := decoder.Decode(&params)
 	if err != nil {
 		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	if params.URL == "" {
+		respondWithError(w, 400, "The URL of the feed is required.")
+		return
+	}
+	// the feed is fetched from inside our network, which users must not reach
+	err = apiCfg.Fetcher.checkURL(r.Context(), params.URL)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("The URL of the feed is not allowed: %v", err))
+		return
 	}
 
-	// check if a feed with the same ULR already exists
-	_, err = apiCfg.DB.GetFeedByURL(r.Context(), database.GetFeedByURLParams{
-		UserID: user.ID,
-		Url:    params.URL,
-	})
+	// users often give the URL of a site instead of the URL of its feed, the
+	// feed is looked up on the site then. URLs that can't be fetched right now
+	// are followed as given, the scraper retries them.
+	candidates, err := apiCfg.Fetcher.discoverFeeds(r.Context(), params.URL)
+	if fetchErrorKind(err) == fetchErrorBlocked {
+		respondWithError(w, 400, fmt.Sprintf("The URL of the feed is not allowed: %v", err))
+		return
+	}
 	if err == nil {
-		respondWithError(w, 400, "An RSS feed with this URL already exists.")
+		switch len(candidates) {
+		case 0:
+			respondWithError(w, 400, "No RSS feed was found at this URL.")
+			return
+		case 1:
+			params.URL = candidates[0].Url
+			if params.Name == "" {
+				params.Name = candidates[0].Title
+			}
+		default:
+			respondWithCandidates(w, candidates)
+			return
+		}
+	}
+	if params.Name == "" {
+		params.Name = params.URL
+	}
+
+	feed, err := followFeed(r.Context(), apiCfg.DB, user, params.Name, params.URL, uuid.NullUUID{})
+	if errors.Is(err, errAlreadyFollowing) {
+		respondWithError(w, 400, "You already follow an RSS feed with this URL.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't follow feed: %v", err))
 		return
 	}
+	respondWithJSON(w, 201, feed)
+}
+
+var errAlreadyFollowing = errors.New("the feed is already followed")
 
-	feed, err := apiCfg.DB.CreateFeed(r.Context(), database.CreateFeedParams{
-		Name:      params.Name,
-		Url:       params.URL,
+// followFeed makes a user follow the feed at a URL, optionally in one of
+// their folders. Feeds are shared, the feed is only created if nobody follows
+// it yet, and a URL a feed moved away from is followed at the feed's new URL.
+// errAlreadyFollowing is returned if the user follows it already.
+func followFeed(ctx context.Context, db *database.Queries, user database.User, name, feedURL string, folderID uuid.NullUUID) (Feed, error) {
+	movedURL, err := db.GetMovedFeedURL(ctx, feedURL)
+	if err == nil {
+		feedURL = movedURL
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return Feed{}, fmt.Errorf("couldn't look up moved feeds: %w", err)
+	}
+	feed, err := db.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		Name:      name,
+		Url:       feedURL,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return Feed{}, fmt.Errorf("couldn't create feed: %w", err)
+	}
+
+	feedFollow, err := db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{
 		ID:        uuid.New(),
-		UserID:    user.ID,
 		CreatedAt: time.Now().UTC(),
 		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+		Name:      name,
+		FolderID:  folderID,
 	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return Feed{}, errAlreadyFollowing
+	}
+	if err != nil {
+		return Feed{}, err
+	}
+	return databaseFeedFollowToFeed(feedFollow, feed), nil
+}
+
+// respondWithCandidates asks the user to pick one of several feeds found at
+// the URL they gave
+func respondWithCandidates(w http.ResponseWriter, candidates []FeedCandidate) {
+	type multipleFeedsResponse struct {
+		Error      string          `json:"error"`
+		Candidates []FeedCandidate `json:"candidates"`
+	}
+	respondWithJSON(w, 300, multipleFeedsResponse{
+		Error:      "Several RSS feeds were found at this URL, follow one of them by its URL.",
+		Candidates: candidates,
+	})
+}
+
+func (apiCfg *apiConfig) handlerDiscoverFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		URL string `json:"url"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	if params.URL == "" {
+		respondWithError(w, 400, "The URL is required.")
+		return
+	}
+	err = apiCfg.Fetcher.checkURL(r.Context(), params.URL)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Couldn't create feed: %v", err))
+		respondWithError(w, 400, fmt.Sprintf("The URL is not allowed: %v", err))
+		return
+	}
+
+	candidates, err := apiCfg.Fetcher.discoverFeeds(r.Context(), params.URL)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Couldn't fetch the URL: %v", err))
+		return
 	}
-	respondWithJSON(w, 201, databaseFeedToFeed(feed))
+	if len(candidates) == 0 {
+		respondWithError(w, 404, "No RSS feeds were found at this URL.")
+		return
+	}
+	respondWithJSON(w, 200, candidates)
 }
 
 func (apiCfg *apiConfig) handlerGetFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
-	feeds, err := apiCfg.DB.GetFeedsOfUser(r.Context(), user.ID)
+	feedFollows, err := apiCfg.DB.GetFeedFollowsOfUser(r.Context(), user.ID)
 	if err != nil {
 		respondWithError(w, 500, fmt.Sprintf("Error fetching feeds: %v", err))
 		return
 	}
-	if feeds == nil {
+	if feedFollows == nil {
 		respondWithError(w, 404, fmt.Sprintf("No feeds exist for user with ID %v", user.ID))
 		return
 	}
-	respondWithJSON(w, 200, databaseFeedsToFeeds(feeds))
+	unreadCounts, err := apiCfg.DB.GetUnreadCountsOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error counting unread posts: %v", err))
+		return
+	}
+	unread := map[uuid.UUID]int64{}
+	for _, count := range unreadCounts {
+		unread[count.FeedID] = count.Unread
+	}
+	feeds := databaseFeedFollowsToFeeds(feedFollows)
+	for i := range feeds {
+		feeds[i].UnreadCount = unread[feeds[i].ID]
+	}
+	respondWithJSON(w, 200, feeds)
 }
 
+// handlerDeleteFeed unfollows a feed, the feed itself and its posts are kept
+// for its other followers
 func (apiCfg *apiConfig) handlerDeleteFeed(w http.ResponseWriter, r *http.Request, user database.User) {
 	feedIdStr := chi.URLParam(r, "feedID")
 	feedId, err := uuid.Parse(feedIdStr)
@@ -67,13 +199,41 @@ func (apiCfg *apiConfig) handlerDeleteFeed(w http.ResponseWriter, r *http.Reques
 		respondWithError(w, 500, fmt.Sprintf("Error parsing feed ID: %v", err))
 		return
 	}
-	err = apiCfg.DB.DeleteFeed(r.Context(), database.DeleteFeedParams{
+	deleted, err := apiCfg.DB.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{
 		UserID: user.ID,
-		ID:     feedId,
+		FeedID: feedId,
 	})
 	if err != nil {
 		respondWithError(w, 500, fmt.Sprintf("Couldn't delete feed: %v", err))
 		return
 	}
+	if deleted == 0 {
+		respondWithError(w, 404, fmt.Sprintf("You don't follow a feed with ID %v", feedId))
+		return
+	}
+	respondWithJSON(w, 204, struct{}{})
+}
+
+// handlerEnableFeed enables a feed that was disabled after failing too often
+// or answering with 410 Gone, with a fresh set of attempts. Feeds are shared,
+// so it's enabled for all of its followers.
+func (apiCfg *apiConfig) handlerEnableFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedId, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing feed ID: %v", err))
+		return
+	}
+	enabled, err := apiCfg.DB.EnableFeed(r.Context(), database.EnableFeedParams{
+		ID:     feedId,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't enable feed: %v", err))
+		return
+	}
+	if enabled == 0 {
+		respondWithError(w, 404, fmt.Sprintf("You don't follow a feed with ID %v", feedId))
+		return
+	}
 	respondWithJSON(w, 204, struct{}{})
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+	"github.com/lib/pq"
+)
+
+// codes of the errors Postgres fails statements with on unique and foreign
+// key violations
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+func (apiCfg *apiConfig) handlerCreateFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Name string `json:"name"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		respondWithError(w, 400, "The name of the folder is required.")
+		return
+	}
+
+	folder, err := apiCfg.DB.CreateFolder(r.Context(), database.CreateFolderParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Name:      params.Name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 400, "You already have a folder with this name.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't create folder: %v", err))
+		return
+	}
+	respondWithJSON(w, 201, databaseFolderToFolder(folder))
+}
+
+// handlerGetFolders lists the folders of the user along with the number of
+// unread posts of the feeds in them
+func (apiCfg *apiConfig) handlerGetFolders(w http.ResponseWriter, r *http.Request, user database.User) {
+	dbFolders, err := apiCfg.DB.GetFoldersOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching folders: %v", err))
+		return
+	}
+	feedFollows, err := apiCfg.DB.GetFeedFollowsOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching feeds: %v", err))
+		return
+	}
+	unreadCounts, err := apiCfg.DB.GetUnreadCountsOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error counting unread posts: %v", err))
+		return
+	}
+	unread := map[uuid.UUID]int64{}
+	for _, count := range unreadCounts {
+		unread[count.FeedID] = count.Unread
+	}
+	folderUnread := map[uuid.UUID]int64{}
+	for _, feedFollow := range feedFollows {
+		if feedFollow.FeedFollow.FolderID.Valid {
+			folderUnread[feedFollow.FeedFollow.FolderID.UUID] += unread[feedFollow.Feed.ID]
+		}
+	}
+	folders := databaseFoldersToFolders(dbFolders)
+	for i := range folders {
+		folders[i].UnreadCount = folderUnread[folders[i].ID]
+	}
+	respondWithJSON(w, 200, folders)
+}
+
+func (apiCfg *apiConfig) handlerRenameFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	folderId, err := uuid.Parse(chi.URLParam(r, "folderID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing folder ID: %v", err))
+		return
+	}
+	type parameters struct {
+		Name string `json:"name"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" {
+		respondWithError(w, 400, "The name of the folder is required.")
+		return
+	}
+
+	folder, err := apiCfg.DB.RenameFolder(r.Context(), database.RenameFolderParams{
+		ID:     folderId,
+		UserID: user.ID,
+		Name:   params.Name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, fmt.Sprintf("You have no folder with ID %v", folderId))
+		return
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		respondWithError(w, 400, "You already have a folder with this name.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't rename folder: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, databaseFolderToFolder(folder))
+}
+
+// handlerDeleteFolder deletes a folder, the feeds in it are kept and are in
+// no folder afterwards. Folders that output feeds are filtered by can't be
+// deleted, the output feeds have to be deleted first.
+func (apiCfg *apiConfig) handlerDeleteFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	folderId, err := uuid.Parse(chi.URLParam(r, "folderID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing folder ID: %v", err))
+		return
+	}
+	deleted, err := apiCfg.DB.DeleteFolder(r.Context(), database.DeleteFolderParams{
+		ID:     folderId,
+		UserID: user.ID,
+	})
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+		respondWithError(w, 409, "The folder is used by output feeds, delete them before deleting the folder.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't delete folder: %v", err))
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, fmt.Sprintf("You have no folder with ID %v", folderId))
+		return
+	}
+	respondWithJSON(w, 204, struct{}{})
+}
+
+// handlerMoveFeedToFolder puts a followed feed into one of the user's
+// folders, or takes it out of its folder if the folder ID is null
+func (apiCfg *apiConfig) handlerMoveFeedToFolder(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedId, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing feed ID: %v", err))
+		return
+	}
+	type parameters struct {
+		FolderID *uuid.UUID `json:"folderId"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+
+	dbParams := database.UpdateFeedFollowFolderParams{
+		UserID: user.ID,
+		FeedID: feedId,
+	}
+	if params.FolderID != nil {
+		dbParams.FolderID = uuid.NullUUID{UUID: *params.FolderID, Valid: true}
+	}
+	updated, err := apiCfg.DB.UpdateFeedFollowFolder(r.Context(), dbParams)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't move feed: %v", err))
+		return
+	}
+	if updated == 0 {
+		respondWithError(w, 404, "You don't follow a feed with this ID or have no folder with this ID.")
+		return
+	}
+	respondWithJSON(w, 204, struct{}{})
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// max size of an OPML document to import
+const maxOPMLSize = 1 << 20
+
+const (
+	// number of the URLs of an OPML document checked in parallel
+	opmlCheckConcurrency = 10
+	// time the URLs of an OPML document are checked for in total
+	opmlCheckTimeout = 10 * time.Second
+)
+
+// outcomes of importing the outlines of an OPML document
+const (
+	importCreated   = "created"
+	importDuplicate = "duplicate"
+	importInvalid   = "invalid"
+)
+
+type importedOutline struct {
+	Title  string `json:"title"`
+	Url    string `json:"url"`
+	Folder string `json:"folder,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handlerImportFeeds follows the feeds listed in the OPML document of the
+// request body, putting them into folders by the outlines they're nested in.
+// The URLs are validated like those of POST /feeds, but aren't looked up as
+// web pages, as OPML lists the URLs of feeds. The feeds are followed in one
+// transaction, so the import is either done as reported or not at all.
+func (apiCfg *apiConfig) handlerImportFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	dat, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxOPMLSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, 413, fmt.Sprintf("The OPML document is larger than %d bytes.", maxOPMLSize))
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error reading the request body: %v", err))
+		return
+	}
+	doc, err := parseOPML(r.Header.Get("Content-Type"), dat)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing OPML document: %v", err))
+		return
+	}
+
+	subscriptions := doc.subscriptions()
+	invalid := apiCfg.checkSubscriptionURLs(r.Context(), subscriptions)
+
+	tx, err := apiCfg.Conn.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't start the import: %v", err))
+		return
+	}
+	defer tx.Rollback()
+	db := apiCfg.DB.WithTx(tx)
+
+	dbFolders, err := db.GetFoldersOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching folders: %v", err))
+		return
+	}
+	folderIds := map[string]uuid.UUID{}
+	for _, folder := range dbFolders {
+		folderIds[folder.Name] = folder.ID
+	}
+
+	type response struct {
+		Created    int               `json:"created"`
+		Duplicates int               `json:"duplicates"`
+		Invalid    int               `json:"invalid"`
+		Outlines   []importedOutline `json:"outlines"`
+	}
+	report := response{Outlines: []importedOutline{}}
+	for i, subscription := range subscriptions {
+		outline := importedOutline{Title: subscription.Title, Url: subscription.URL, Folder: subscription.Folder}
+		if invalid[i] != "" {
+			outline.Status = importInvalid
+			outline.Error = invalid[i]
+			report.Invalid++
+			report.Outlines = append(report.Outlines, outline)
+			continue
+		}
+
+		folderId := uuid.NullUUID{}
+		if subscription.Folder != "" {
+			id, ok := folderIds[subscription.Folder]
+			if !ok {
+				folder, err := db.CreateFolder(r.Context(), database.CreateFolderParams{
+					ID:        uuid.New(),
+					CreatedAt: time.Now().UTC(),
+					UpdatedAt: time.Now().UTC(),
+					UserID:    user.ID,
+					Name:      subscription.Folder,
+				})
+				if err != nil {
+					respondWithError(w, 500, fmt.Sprintf("Couldn't create folder: %v", err))
+					return
+				}
+				id = folder.ID
+				folderIds[folder.Name] = id
+			}
+			folderId = uuid.NullUUID{UUID: id, Valid: true}
+		}
+
+		name := subscription.Title
+		if name == "" {
+			name = subscription.URL
+		}
+		_, err = followFeed(r.Context(), db, user, name, subscription.URL, folderId)
+		if errors.Is(err, errAlreadyFollowing) {
+			outline.Status = importDuplicate
+			report.Duplicates++
+			report.Outlines = append(report.Outlines, outline)
+			continue
+		}
+		if err != nil {
+			respondWithError(w, 500, fmt.Sprintf("Couldn't follow feed: %v", err))
+			return
+		}
+		outline.Status = importCreated
+		report.Created++
+		report.Outlines = append(report.Outlines, outline)
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't save the import: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, report)
+}
+
+// checkSubscriptionURLs checks the URLs of the subscriptions of an OPML
+// document in parallel, as the feeds are fetched from inside our network,
+// which users must not reach. It returns why each URL is invalid, or "" if
+// it's valid. URLs that couldn't be checked within opmlCheckTimeout are
+// invalid, so a slow DNS server doesn't hold up the import.
+func (apiCfg *apiConfig) checkSubscriptionURLs(ctx context.Context, subscriptions []opmlSubscription) []string {
+	ctx, cancel := context.WithTimeout(ctx, opmlCheckTimeout)
+	defer cancel()
+
+	const timedOut = "The URL of the feed couldn't be checked in time, import it again."
+	invalid := make([]string, len(subscriptions))
+	sem := make(chan struct{}, opmlCheckConcurrency)
+	wg := sync.WaitGroup{}
+	for i, subscription := range subscriptions {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			invalid[i] = timedOut
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := apiCfg.Fetcher.checkURL(ctx, subscription.URL)
+			if err != nil && ctx.Err() != nil {
+				invalid[i] = timedOut
+			} else if err != nil {
+				invalid[i] = fmt.Sprintf("The URL of the feed is not allowed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return invalid
+}
+
+// handlerExportFeeds returns the feeds the user follows as an OPML document
+func (apiCfg *apiConfig) handlerExportFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedFollows, err := apiCfg.DB.GetFeedFollowsOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching feeds: %v", err))
+		return
+	}
+	dbFolders, err := apiCfg.DB.GetFoldersOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching folders: %v", err))
+		return
+	}
+
+	doc := newOPMLDocument(
+		fmt.Sprintf("Feeds of %s on scraperss", user.Name),
+		databaseFeedFollowsToFeeds(feedFollows),
+		databaseFoldersToFolders(dbFolders),
+		time.Now(),
+	)
+	dat, err := doc.marshal()
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	w.Header().Add("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Add("Content-Disposition", `attachment; filename="scraperss.opml"`)
+	w.WriteHeader(200)
+	w.Write(dat)
+}
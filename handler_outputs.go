@@ -0,0 +1,230 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+func (apiCfg *apiConfig) handlerCreateOutputFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Title    string     `json:"title"`
+		FeedID   *uuid.UUID `json:"feedId"`
+		FolderID *uuid.UUID `json:"folderId"`
+		Tag      string     `json:"tag"`
+		Keyword  string     `json:"keyword"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	params.Title = strings.TrimSpace(params.Title)
+	if params.Title == "" {
+		params.Title = fmt.Sprintf("Posts of %s", user.Name)
+	}
+
+	dbParams := database.CreateOutputFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Title:     params.Title,
+	}
+	if params.FeedID != nil {
+		feedFollows, err := apiCfg.DB.GetFeedFollowsOfUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, fmt.Sprintf("Error fetching feeds: %v", err))
+			return
+		}
+		if !followsFeed(feedFollows, *params.FeedID) {
+			respondWithError(w, 400, fmt.Sprintf("You don't follow a feed with ID %v", *params.FeedID))
+			return
+		}
+		dbParams.FeedID = uuid.NullUUID{UUID: *params.FeedID, Valid: true}
+	}
+	if params.FolderID != nil {
+		folders, err := apiCfg.DB.GetFoldersOfUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, fmt.Sprintf("Error fetching folders: %v", err))
+			return
+		}
+		if !hasFolder(folders, *params.FolderID) {
+			respondWithError(w, 400, fmt.Sprintf("You have no folder with ID %v", *params.FolderID))
+			return
+		}
+		dbParams.FolderID = uuid.NullUUID{UUID: *params.FolderID, Valid: true}
+	}
+	if tag := strings.TrimSpace(params.Tag); tag != "" {
+		dbParams.Tag = sql.NullString{String: tag, Valid: true}
+	}
+	if keyword := strings.TrimSpace(params.Keyword); keyword != "" {
+		dbParams.Keyword = sql.NullString{String: keyword, Valid: true}
+	}
+	dbParams.Token, err = newRandomToken()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't generate a token for the output feed: %v", err))
+		return
+	}
+
+	outputFeed, err := apiCfg.DB.CreateOutputFeed(r.Context(), dbParams)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't create output feed: %v", err))
+		return
+	}
+	respondWithJSON(w, 201, databaseOutputFeedToOutputFeed(outputFeed, apiCfg.baseURL(r)))
+}
+
+func (apiCfg *apiConfig) handlerGetOutputFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	outputFeeds, err := apiCfg.DB.GetOutputFeedsOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching output feeds: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, databaseOutputFeedsToOutputFeeds(outputFeeds, apiCfg.baseURL(r)))
+}
+
+// handlerDeleteOutputFeed deletes an output feed, its URLs stop working
+func (apiCfg *apiConfig) handlerDeleteOutputFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	outputFeedId, err := uuid.Parse(chi.URLParam(r, "outputFeedID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing output feed ID: %v", err))
+		return
+	}
+	deleted, err := apiCfg.DB.DeleteOutputFeed(r.Context(), database.DeleteOutputFeedParams{
+		ID:     outputFeedId,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't delete output feed: %v", err))
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, fmt.Sprintf("You have no output feed with ID %v", outputFeedId))
+		return
+	}
+	respondWithJSON(w, 204, struct{}{})
+}
+
+// handlerServeOutputFeed renders an output feed in the format of the URL. The
+// token in the URL authorizes the request, so that feed readers and static
+// sites can subscribe to the feed without an API key.
+func (apiCfg *apiConfig) handlerServeOutputFeed(w http.ResponseWriter, r *http.Request) {
+	format := chi.URLParam(r, "format")
+	contentType, ok := outputContentTypes[format]
+	if !ok {
+		respondWithError(w, 404, "Output feeds are served in the formats rss, atom and json.")
+		return
+	}
+	outputFeed, err := apiCfg.DB.GetOutputFeedByToken(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "No output feed exists at this URL.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching output feed: %v", err))
+		return
+	}
+
+	posts, err := apiCfg.DB.GetPostsForOutputFeed(r.Context(), database.GetPostsForOutputFeedParams{
+		UserID:   outputFeed.UserID,
+		FeedID:   outputFeed.FeedID,
+		FolderID: outputFeed.FolderID,
+		Tag:      outputFeed.Tag,
+		Keyword:  sql.NullString{String: escapeLike(outputFeed.Keyword.String), Valid: outputFeed.Keyword.Valid},
+		Limit:    outputFeedLimit,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching posts: %v", err))
+		return
+	}
+	postIds := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.ID)
+	}
+	enclosures, err := apiCfg.DB.GetEnclosuresForPosts(r.Context(), postIds)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching enclosures of posts: %v", err))
+		return
+	}
+
+	selfURL := outputFeedURL(apiCfg.baseURL(r), outputFeed.Token, format)
+	doc := newOutputDocument(outputFeed, selfURL, databasePostsToPosts(posts, enclosures, nil))
+	dat, err := doc.render(format)
+	if err != nil {
+		respondWithError(w, 500, err.Error())
+		return
+	}
+	w.Header().Add("Content-Type", contentType)
+	w.Header().Add("Last-Modified", doc.Updated.UTC().Format(http.TimeFormat))
+	w.WriteHeader(200)
+	w.Write(dat)
+}
+
+// newRandomToken returns a random token, for the URLs of output feeds and the
+// secrets of webhooks
+func newRandomToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// baseURL returns the URL of the v1 API as seen by clients. Without a
+// configured public URL, it's the URL a request was sent to, as told by the
+// proxy in front of the service if its headers are trusted.
+func (apiCfg *apiConfig) baseURL(r *http.Request) string {
+	if apiCfg.PublicURL != "" {
+		return apiCfg.PublicURL + "/v1"
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+	if apiCfg.TrustProxyHeaders {
+		if proto := strings.ToLower(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	return scheme + "://" + host + "/v1"
+}
+
+func outputFeedURL(baseURL, token, format string) string {
+	return baseURL + "/output/" + token + "/" + format
+}
+
+func followsFeed(feedFollows []database.GetFeedFollowsOfUserRow, feedId uuid.UUID) bool {
+	for _, feedFollow := range feedFollows {
+		if feedFollow.Feed.ID == feedId {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFolder(folders []database.Folder, folderId uuid.UUID) bool {
+	for _, folder := range folders {
+		if folder.ID == folderId {
+			return true
+		}
+	}
+	return false
+}
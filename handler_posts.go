@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+const defaultPostsLimit = 20
+const maxPostsLimit = 100
+
+func (apiCfg *apiConfig) handlerGetPosts(w http.ResponseWriter, r *http.Request, user database.User) {
+	query := r.URL.Query()
+	params := database.GetPostsForUserParams{
+		UserID: user.ID,
+		Limit:  defaultPostsLimit,
+	}
+
+	// page size
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxPostsLimit {
+			respondWithError(w, 400, fmt.Sprintf("limit must be a number between 1 and %d", maxPostsLimit))
+			return
+		}
+		params.Limit = int32(limit)
+	}
+
+	// filters
+	if feedIdStr := query.Get("feed_id"); feedIdStr != "" {
+		feedId, err := uuid.Parse(feedIdStr)
+		if err != nil {
+			respondWithError(w, 400, fmt.Sprintf("Error parsing feed ID: %v", err))
+			return
+		}
+		params.FeedID = uuid.NullUUID{UUID: feedId, Valid: true}
+	}
+	if folderIdStr := query.Get("folder_id"); folderIdStr != "" {
+		folderId, err := uuid.Parse(folderIdStr)
+		if err != nil {
+			respondWithError(w, 400, fmt.Sprintf("Error parsing folder ID: %v", err))
+			return
+		}
+		params.FolderID = uuid.NullUUID{UUID: folderId, Valid: true}
+	}
+	for key, dst := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		val := query.Get(key)
+		if val == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			respondWithError(w, 400, fmt.Sprintf("%s must be an RFC 3339 timestamp: %v", key, err))
+			return
+		}
+		*dst = sql.NullTime{Time: t.UTC(), Valid: true}
+	}
+	if title := strings.TrimSpace(query.Get("title")); title != "" {
+		params.Title = sql.NullString{String: escapeLike(title), Valid: true}
+	}
+	for key, dst := range map[string]*sql.NullBool{"read": &params.Read, "starred": &params.Starred, "archived": &params.Archived} {
+		val := query.Get(key)
+		if val == "" {
+			continue
+		}
+		state, err := strconv.ParseBool(val)
+		if err != nil {
+			respondWithError(w, 400, fmt.Sprintf("%s must be either 'true' or 'false'", key))
+			return
+		}
+		*dst = sql.NullBool{Bool: state, Valid: true}
+	}
+
+	// cursor from the previous page
+	if cursor := query.Get("cursor"); cursor != "" {
+		pubAt, postId, err := decodePostsCursor(cursor)
+		if err != nil {
+			respondWithError(w, 400, fmt.Sprintf("Invalid cursor: %v", err))
+			return
+		}
+		params.CursorPublishedAt = sql.NullTime{Time: pubAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: postId, Valid: true}
+	}
+
+	// fetch one extra post to find out if there is a next page
+	pageSize := int(params.Limit)
+	params.Limit++
+
+	var posts []database.Post
+	var err error
+	switch query.Get("sort") {
+	case "", "newest":
+		posts, err = apiCfg.DB.GetPostsForUser(r.Context(), params)
+	case "oldest":
+		posts, err = apiCfg.DB.GetPostsForUserOldestFirst(r.Context(), database.GetPostsForUserOldestFirstParams(params))
+	default:
+		respondWithError(w, 400, "sort must be either 'newest' or 'oldest'")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching posts: %v", err))
+		return
+	}
+
+	page := PostsPage{}
+	if len(posts) > pageSize {
+		posts = posts[:pageSize]
+		last := posts[len(posts)-1]
+		page.NextCursor = encodePostsCursor(last.PublishedAt, last.ID)
+	}
+	postIds := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.ID)
+	}
+	enclosures, err := apiCfg.DB.GetEnclosuresForPosts(r.Context(), postIds)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching enclosures of posts: %v", err))
+		return
+	}
+	states, err := apiCfg.DB.GetPostStatesForPosts(r.Context(), database.GetPostStatesForPostsParams{
+		UserID:  user.ID,
+		PostIds: postIds,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching states of posts: %v", err))
+		return
+	}
+	page.Posts = databasePostsToPosts(posts, enclosures, states)
+	respondWithJSON(w, 200, page)
+}
+
+func (apiCfg *apiConfig) handlerUpdatePostState(w http.ResponseWriter, r *http.Request, user database.User) {
+	postId, err := uuid.Parse(chi.URLParam(r, "postID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing post ID: %v", err))
+		return
+	}
+	// states left out of the request are kept
+	type parameters struct {
+		Read     *bool `json:"read"`
+		Starred  *bool `json:"starred"`
+		Archived *bool `json:"archived"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+
+	state, err := apiCfg.DB.UpdatePostState(r.Context(), database.UpdatePostStateParams{
+		Read:     nullBool(params.Read),
+		Starred:  nullBool(params.Starred),
+		Archived: nullBool(params.Archived),
+		UserID:   user.ID,
+		PostID:   postId,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "No post with this ID exists in the feeds you follow.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't update the state of the post: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, databasePostStateToPostState(state))
+}
+
+func (apiCfg *apiConfig) handlerMarkPostsRead(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		FeedID   *uuid.UUID `json:"feedId"`
+		FolderID *uuid.UUID `json:"folderId"`
+		Before   time.Time  `json:"before"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	if params.Before.IsZero() {
+		respondWithError(w, 400, "before is required, as an RFC 3339 timestamp.")
+		return
+	}
+
+	dbParams := database.MarkPostsReadParams{
+		UserID: user.ID,
+		Before: params.Before.UTC(),
+	}
+	if params.FeedID != nil {
+		dbParams.FeedID = uuid.NullUUID{UUID: *params.FeedID, Valid: true}
+	}
+	if params.FolderID != nil {
+		dbParams.FolderID = uuid.NullUUID{UUID: *params.FolderID, Valid: true}
+	}
+	marked, err := apiCfg.DB.MarkPostsRead(r.Context(), dbParams)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't mark posts as read: %v", err))
+		return
+	}
+	type response struct {
+		Marked int64 `json:"marked"`
+	}
+	respondWithJSON(w, 200, response{Marked: marked})
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns, see escapeLike
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes user input matched with ILIKE, so that % and _ match
+// themselves instead of any characters
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// nullBool turns an optional boolean of a request into a query parameter
+func nullBool(val *bool) sql.NullBool {
+	if val == nil {
+		return sql.NullBool{}
+	}
+	return sql.NullBool{Bool: *val, Valid: true}
+}
+
+// cursors are opaque to clients and carry the sort key of the last post on a page
+func encodePostsCursor(publishedAt time.Time, id uuid.UUID) string {
+	raw := publishedAt.UTC().Format(time.RFC3339Nano) + "," + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodePostsCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, err
+	}
+	pubAtStr, idStr, found := strings.Cut(string(raw), ",")
+	if !found {
+		return time.Time{}, uuid.UUID{}, errors.New("malformed cursor")
+	}
+	pubAt, err := time.Parse(time.RFC3339Nano, pubAtStr)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, err
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return time.Time{}, uuid.UUID{}, err
+	}
+	return pubAt.UTC(), id, nil
+}
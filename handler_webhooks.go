@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// number of the latest deliveries returned for a webhook
+const webhookDeliveriesLimit = 50
+
+// handlerCreateWebhook registers an endpoint that new posts are sent to. The
+// secret signing the deliveries is only returned in the response.
+func (apiCfg *apiConfig) handlerCreateWebhook(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Url      string      `json:"url"`
+		FeedIds  []uuid.UUID `json:"feedIds"`
+		Keywords []string    `json:"keywords"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing JSON in the request body: %v", err))
+		return
+	}
+	params.Url = strings.TrimSpace(params.Url)
+	if params.Url == "" {
+		respondWithError(w, 400, "The URL of the webhook is required.")
+		return
+	}
+	// deliveries are sent from inside our network, which users must not reach
+	err = apiCfg.Fetcher.checkURL(r.Context(), params.Url)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("The URL of the webhook is not allowed: %v", err))
+		return
+	}
+
+	feedIds := []uuid.UUID{}
+	if len(params.FeedIds) > 0 {
+		feedFollows, err := apiCfg.DB.GetFeedFollowsOfUser(r.Context(), user.ID)
+		if err != nil {
+			respondWithError(w, 500, fmt.Sprintf("Error fetching feeds: %v", err))
+			return
+		}
+		for _, feedId := range params.FeedIds {
+			if !followsFeed(feedFollows, feedId) {
+				respondWithError(w, 400, fmt.Sprintf("You don't follow a feed with ID %v", feedId))
+				return
+			}
+			feedIds = append(feedIds, feedId)
+		}
+	}
+	keywords := []string{}
+	for _, keyword := range params.Keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, keyword)
+		}
+	}
+
+	secret, err := newRandomToken()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't generate a secret for the webhook: %v", err))
+		return
+	}
+	webhook, err := apiCfg.DB.CreateWebhook(r.Context(), database.CreateWebhookParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+		UserID:    user.ID,
+		Url:       params.Url,
+		Secret:    secret,
+		FeedIds:   feedIds,
+		Keywords:  keywords,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't create webhook: %v", err))
+		return
+	}
+	response := databaseWebhookToWebhook(webhook)
+	response.Secret = webhook.Secret
+	respondWithJSON(w, 201, response)
+}
+
+func (apiCfg *apiConfig) handlerGetWebhooks(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhooks, err := apiCfg.DB.GetWebhooksOfUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching webhooks: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, databaseWebhooksToWebhooks(webhooks))
+}
+
+// handlerDeleteWebhook deletes a webhook along with its pending deliveries
+func (apiCfg *apiConfig) handlerDeleteWebhook(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhookId, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing webhook ID: %v", err))
+		return
+	}
+	deleted, err := apiCfg.DB.DeleteWebhook(r.Context(), database.DeleteWebhookParams{
+		ID:     webhookId,
+		UserID: user.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't delete webhook: %v", err))
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, fmt.Sprintf("You have no webhook with ID %v", webhookId))
+		return
+	}
+	respondWithJSON(w, 204, struct{}{})
+}
+
+// handlerGetWebhookDeliveries returns the latest deliveries to a webhook with
+// their payloads and the log of their attempts
+func (apiCfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhookId, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing webhook ID: %v", err))
+		return
+	}
+	webhook, err := apiCfg.DB.GetWebhookByID(r.Context(), webhookId)
+	if errors.Is(err, sql.ErrNoRows) || err == nil && webhook.UserID != user.ID {
+		respondWithError(w, 404, fmt.Sprintf("You have no webhook with ID %v", webhookId))
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching webhook: %v", err))
+		return
+	}
+
+	deliveries, err := apiCfg.DB.GetDeliveriesOfWebhook(r.Context(), database.GetDeliveriesOfWebhookParams{
+		WebhookID: webhook.ID,
+		Limit:     webhookDeliveriesLimit,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching deliveries: %v", err))
+		return
+	}
+	deliveryIds := make([]uuid.UUID, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		deliveryIds = append(deliveryIds, delivery.ID)
+	}
+	attempts, err := apiCfg.DB.GetAttemptsForDeliveries(r.Context(), deliveryIds)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching attempts of deliveries: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, databaseDeliveriesToDeliveries(deliveries, attempts))
+}
+
+// handlerRedeliverWebhookDelivery queues a delivery to be sent again right
+// away, with a fresh set of attempts. Its payload is sent unchanged.
+func (apiCfg *apiConfig) handlerRedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request, user database.User) {
+	webhookId, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing webhook ID: %v", err))
+		return
+	}
+	deliveryId, err := uuid.Parse(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error parsing delivery ID: %v", err))
+		return
+	}
+	delivery, err := apiCfg.DB.RedeliverWebhookDelivery(r.Context(), database.RedeliverWebhookDeliveryParams{
+		ID:        deliveryId,
+		WebhookID: webhookId,
+		UserID:    user.ID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, fmt.Sprintf("You have no delivery with ID %v to webhook %v", deliveryId, webhookId))
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Couldn't redeliver: %v", err))
+		return
+	}
+	attempts, err := apiCfg.DB.GetAttemptsForDeliveries(r.Context(), []uuid.UUID{delivery.ID})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error fetching attempts of delivery: %v", err))
+		return
+	}
+	respondWithJSON(w, 202, databaseDeliveriesToDeliveries([]database.WebhookDelivery{delivery}, attempts)[0])
+}
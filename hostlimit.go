@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// feeds that would wait longer than this for their host's rate limit are
+// scheduled for later instead of holding on to a worker
+const maxHostRateWait = 10 * time.Second
+
+// hostLimits of the requests sent to one host
+type hostLimits struct {
+	// number of feeds of the host scraped in parallel
+	Concurrency int `yaml:"concurrency"`
+	// requests per second, with bursts of up to Burst requests
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// hostLimiter limits the number of feeds scraped at the same time and the
+// rate of requests per host. Feeds of a host that is at its concurrency limit
+// are deferred instead of blocking a worker, and are handed to the next
+// worker finishing a feed of that host.
+//
+// Hosts are limited by their hostname, unless they fall under a domain with
+// overridden limits, in which case all hosts of that domain share the limits.
+type hostLimiter struct {
+	mu        sync.Mutex
+	defaults  hostLimits
+	overrides map[string]hostLimits
+	active    map[string]int
+	deferred  map[string][]database.Feed
+	buckets   map[string]*tokenBucket
+	// number of deferred feeds of all hosts
+	waiting int
+}
+
+func newHostLimiter(defaults hostLimits, overrides map[string]hostLimits) *hostLimiter {
+	normalized := map[string]hostLimits{}
+	for domain, limits := range overrides {
+		normalized[strings.ToLower(strings.TrimSpace(domain))] = limits
+	}
+	return &hostLimiter{
+		defaults:  defaults,
+		overrides: normalized,
+		active:    map[string]int{},
+		deferred:  map[string][]database.Feed{},
+		buckets:   map[string]*tokenBucket{},
+	}
+}
+
+// key returns the key a feed is limited by, its host or the domain with
+// overridden limits it falls under
+func (l *hostLimiter) key(feedURL string) string {
+	host := feedHost(feedURL)
+	key := host
+	for domain := range l.overrides {
+		if (host == domain || strings.HasSuffix(host, "."+domain)) && (key == host || len(domain) > len(key)) {
+			key = domain
+		}
+	}
+	return key
+}
+
+// limits returns the limits of a key, unset overrides fall back to the defaults
+func (l *hostLimiter) limits(key string) hostLimits {
+	limits := l.defaults
+	override, ok := l.overrides[key]
+	if !ok {
+		return limits
+	}
+	if override.Concurrency > 0 {
+		limits.Concurrency = override.Concurrency
+	}
+	if override.Rate > 0 {
+		limits.Rate = override.Rate
+	}
+	if override.Burst > 0 {
+		limits.Burst = override.Burst
+	}
+	return limits
+}
+
+// acquire takes a slot of the key for scraping the feed. If the key is at its
+// limit, the feed is deferred and false is returned.
+func (l *hostLimiter) acquire(key string, feed database.Feed) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key] < l.limits(key).Concurrency {
+		l.active[key]++
+		return true
+	}
+	l.deferred[key] = append(l.deferred[key], feed)
+	l.waiting++
+	return false
+}
+
+// release gives up a slot of the key. If feeds of the key were deferred, the
+// slot is handed over to the next of them, which is returned.
+func (l *hostLimiter) release(key string) (database.Feed, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if queue := l.deferred[key]; len(queue) > 0 {
+		next := queue[0]
+		if len(queue) == 1 {
+			delete(l.deferred, key)
+		} else {
+			l.deferred[key] = queue[1:]
+		}
+		l.waiting--
+		return next, true
+	}
+	l.active[key]--
+	if l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+	return database.Feed{}, false
+}
+
+// reserve takes a token for a request to the key and returns how long to
+// wait before sending the request
+func (l *hostLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		limits := l.limits(key)
+		bucket = &tokenBucket{rate: limits.Rate, burst: float64(limits.Burst), tokens: float64(limits.Burst), last: now}
+		l.buckets[key] = bucket
+	}
+	return bucket.reserve(now)
+}
+
+// cancel gives back a token taken by reserve for a request that wasn't sent
+func (l *hostLimiter) cancel(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bucket, ok := l.buckets[key]; ok && bucket.tokens < bucket.burst {
+		bucket.tokens++
+	}
+}
+
+// deferredCount returns the number of feeds waiting for a slot of their host
+func (l *hostLimiter) deferredCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.waiting
+}
+
+// tokenBucket refills at rate tokens per second up to burst tokens. Tokens
+// may be taken before they are refilled, which makes the bucket go negative
+// and the taker wait.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// feedHost returns the host a feed is fetched from
+func feedHost(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Hostname() == "" {
+		return feedURL
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(hostLimits{Concurrency: 2, Rate: 1, Burst: 1}, nil)
+	feeds := []database.Feed{{ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}, {ID: uuid.New()}}
+
+	if !limiter.acquire("a.example.com", feeds[0]) || !limiter.acquire("a.example.com", feeds[1]) {
+		t.Fatalf("Expected the first two feeds of a host to get a slot")
+	}
+	if limiter.acquire("a.example.com", feeds[2]) {
+		t.Fatalf("Expected the third feed of a host to be deferred")
+	}
+	// other hosts are not affected
+	if !limiter.acquire("b.example.com", feeds[3]) {
+		t.Fatalf("Expected a feed of another host to get a slot")
+	}
+	if got := limiter.deferredCount(); got != 1 {
+		t.Errorf("Wrong number of deferred feeds, got: %v want: 1", got)
+	}
+
+	// the deferred feed takes over the released slot
+	next, ok := limiter.release("a.example.com")
+	if !ok || next.ID != feeds[2].ID {
+		t.Fatalf("Expected the deferred feed to take over the slot, got: %v %v", next.ID, ok)
+	}
+	if got := limiter.deferredCount(); got != 0 {
+		t.Errorf("Wrong number of deferred feeds, got: %v want: 0", got)
+	}
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.release("a.example.com"); ok {
+			t.Errorf("Expected no deferred feeds left")
+		}
+	}
+	if _, ok := limiter.release("b.example.com"); ok {
+		t.Errorf("Expected no deferred feeds left")
+	}
+	if len(limiter.active) != 0 {
+		t.Errorf("Expected no active hosts, got: %v", limiter.active)
+	}
+}
+
+func TestHostLimiterOverrides(t *testing.T) {
+	limiter := newHostLimiter(hostLimits{Concurrency: 2, Rate: 1, Burst: 2}, map[string]hostLimits{
+		"Example.com":       {Concurrency: 4},
+		"feeds.example.com": {Rate: 0.1},
+	})
+	keys := map[string]string{
+		"https://example.com/feed.xml":         "example.com",
+		"https://blog.example.com/feed.xml":    "example.com",
+		"https://a.feeds.example.com/feed.xml": "feeds.example.com",
+		"https://notexample.com/feed.xml":      "notexample.com",
+	}
+	for feedURL, want := range keys {
+		if got := limiter.key(feedURL); got != want {
+			t.Errorf("Wrong key for %q, got: %v want: %v", feedURL, got, want)
+		}
+	}
+
+	limits := map[string]hostLimits{
+		"example.com":       {Concurrency: 4, Rate: 1, Burst: 2},
+		"feeds.example.com": {Concurrency: 2, Rate: 0.1, Burst: 2},
+		"notexample.com":    {Concurrency: 2, Rate: 1, Burst: 2},
+	}
+	for key, want := range limits {
+		if got := limiter.limits(key); got != want {
+			t.Errorf("Wrong limits of %q, got: %+v want: %+v", key, got, want)
+		}
+	}
+}
+
+func TestHostLimiterRate(t *testing.T) {
+	limiter := newHostLimiter(hostLimits{Concurrency: 1, Rate: 2, Burst: 2}, nil)
+	now := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	// a burst is sent right away, the requests after it are spaced out
+	waits := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, want := range waits {
+		if got := limiter.reserve("example.com", now); got != want {
+			t.Errorf("Wrong wait of request %d, got: %v want: %v", i, got, want)
+		}
+	}
+	// other hosts have their own bucket
+	if got := limiter.reserve("other.example.com", now); got != 0 {
+		t.Errorf("Wrong wait of another host, got: %v want: 0", got)
+	}
+	// a cancelled request gives its token back
+	limiter.cancel("example.com")
+	if got := limiter.reserve("example.com", now); got != time.Second {
+		t.Errorf("Wrong wait after a cancel, got: %v want: %v", got, time.Second)
+	}
+	// the bucket refills over time, up to the burst
+	if got := limiter.reserve("example.com", now.Add(time.Minute)); got != 0 {
+		t.Errorf("Wrong wait after a minute, got: %v want: 0", got)
+	}
+	if got := limiter.reserve("example.com", now.Add(time.Minute)); got != 0 {
+		t.Errorf("Wrong wait after a minute, got: %v want: 0", got)
+	}
+	if got := limiter.reserve("example.com", now.Add(time.Minute)); got != 500*time.Millisecond {
+		t.Errorf("Wrong wait past the burst, got: %v want: %v", got, 500*time.Millisecond)
+	}
+}
+
+func TestFeedHost(t *testing.T) {
+	tests := map[string]string{
+		"https://Example.com/feed.xml":  "example.com",
+		"http://example.com:8080/rss":   "example.com",
+		"https://blog.example.com/atom": "blog.example.com",
+		"not a url":                     "not a url",
+	}
+	for feedURL, want := range tests {
+		if got := feedHost(feedURL); got != want {
+			t.Errorf("Wrong host for %q, got: %v want: %v", feedURL, got, want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// feedFetchResult is what gets saved about a successful fetch of a feed
+type feedFetchResult struct {
+	Fetched     fetchedFeed
+	Hints       refreshHints
+	NextFetchAt time.Time
+}
+
+var errLeaseLost = errors.New("the lease on the feed expired and was taken by another scraper")
+
+// ingestFeed saves the posts of a fetched feed together with the feed's fetch
+// metadata in a single transaction, so a failure midway leaves no partial
+// state behind. It returns the number of new or edited posts. Nothing is
+// saved if the scraper lost its lease on the feed, errLeaseLost is returned
+// then.
+func ingestFeed(ctx context.Context, conn *sql.DB, feed database.Feed, leaseOwner string, result feedFetchResult) (int, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	db := database.New(tx)
+
+	if newURL := result.Fetched.PermanentURL; newURL != "" && newURL != feed.Url {
+		merged, err := moveFeed(ctx, db, feed, leaseOwner, newURL)
+		if err != nil {
+			return 0, err
+		}
+		// the posts are saved by the fetches of the feed it was merged into
+		if merged {
+			return 0, tx.Commit()
+		}
+	}
+
+	saved := 0
+	if !result.Fetched.NotModified {
+		err = db.UpdateFeedRefreshHints(ctx, database.UpdateFeedRefreshHintsParams{
+			ID:                     feed.ID,
+			RefreshIntervalSeconds: sql.NullInt32{Int32: int32(result.Hints.Interval.Seconds()), Valid: result.Hints.Interval > 0},
+			SkipHours:              result.Hints.SkipHours,
+			SkipDays:               result.Hints.SkipDays,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("couldn't save refresh hints: %w", err)
+		}
+		saved, err = upsertFeedItems(ctx, db, feed, result.Fetched.Feed.Channel.Item)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	marked, err := db.MarkFeedFetchSucceeded(ctx, database.MarkFeedFetchSucceededParams{
+		NextFetchAt: result.NextFetchAt,
+		ID:          feed.ID,
+		LeaseOwner:  leaseOwner,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't mark the fetch as succeeded: %w", err)
+	}
+	// the other scraper saves the feed, the deferred rollback drops our posts
+	if marked == 0 {
+		return 0, errLeaseLost
+	}
+	// only remember the fetched document along with its posts
+	cache := result.Fetched.Cache
+	err = db.UpdateFeedCacheState(ctx, database.UpdateFeedCacheStateParams{
+		ID:           feed.ID,
+		Etag:         sql.NullString{String: cache.ETag, Valid: cache.ETag != ""},
+		LastModified: sql.NullString{String: cache.LastModified, Valid: cache.LastModified != ""},
+		ContentHash:  sql.NullString{String: cache.ContentHash, Valid: cache.ContentHash != ""},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("couldn't save cache state: %w", err)
+	}
+
+	return saved, tx.Commit()
+}
+
+// moveFeed updates the URL of a feed that was moved with a permanent redirect,
+// keeping its previous URL in the history of the feed. A feed that moved to
+// the URL of another feed is merged into that feed, true is returned then.
+func moveFeed(ctx context.Context, db *database.Queries, feed database.Feed, leaseOwner, newURL string) (bool, error) {
+	moved, err := db.UpdateFeedURL(ctx, database.UpdateFeedURLParams{
+		ID:  feed.ID,
+		Url: newURL,
+	})
+	if err != nil {
+		return false, fmt.Errorf("couldn't update the feed URL: %w", err)
+	}
+	feedID := feed.ID
+	if moved == 0 {
+		target, err := db.GetFeedByURL(ctx, newURL)
+		if err != nil {
+			return false, fmt.Errorf("couldn't get the feed at the new URL: %w", err)
+		}
+		err = mergeFeed(ctx, db, feed, target, leaseOwner)
+		if err != nil {
+			return false, err
+		}
+		feedID = target.ID
+	}
+	err = db.CreateFeedURLChange(ctx, database.CreateFeedURLChangeParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now().UTC(),
+		FeedID:    feedID,
+		OldUrl:    feed.Url,
+		NewUrl:    newURL,
+	})
+	if err != nil {
+		return false, fmt.Errorf("couldn't save the previous feed URL: %w", err)
+	}
+	if moved == 0 {
+		slog.Info("Feed moved permanently to the URL of another feed, merged it into that feed", "feed", feed.Name, "url", feed.Url, "new url", newURL)
+		return true, nil
+	}
+	slog.Info("Feed moved permanently, updated its URL", "feed", feed.Name, "url", feed.Url, "new url", newURL)
+	return false, nil
+}
+
+// mergeFeed merges a feed into the feed at the URL it moved to, so that the
+// same feed isn't fetched and stored twice. Its followers, the posts the
+// target doesn't have, the states users gave its posts and its URL history
+// move to the target, and the feed is deleted. errLeaseLost is returned if
+// the scraper lost its lease on the feed.
+func mergeFeed(ctx context.Context, db *database.Queries, feed, target database.Feed, leaseOwner string) error {
+	err := db.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{ToFeedID: target.ID, FromFeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("couldn't move the followers of the feed: %w", err)
+	}
+	err = db.CopyPostStates(ctx, database.CopyPostStatesParams{ToFeedID: target.ID, FromFeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("couldn't copy the states of posts: %w", err)
+	}
+	err = db.MovePosts(ctx, database.MovePostsParams{ToFeedID: target.ID, FromFeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("couldn't move the posts of the feed: %w", err)
+	}
+	err = db.MoveOutputFeeds(ctx, database.MoveOutputFeedsParams{
+		ToFeedID:   uuid.NullUUID{UUID: target.ID, Valid: true},
+		FromFeedID: uuid.NullUUID{UUID: feed.ID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't move the output feeds of the feed: %w", err)
+	}
+	err = db.ReplaceWebhookFeed(ctx, database.ReplaceWebhookFeedParams{FromFeedID: feed.ID, ToFeedID: target.ID})
+	if err != nil {
+		return fmt.Errorf("couldn't move the webhooks of the feed: %w", err)
+	}
+	err = db.MoveFeedURLChanges(ctx, database.MoveFeedURLChangesParams{ToFeedID: target.ID, FromFeedID: feed.ID})
+	if err != nil {
+		return fmt.Errorf("couldn't move the URL history of the feed: %w", err)
+	}
+	// the remaining follows and posts are duplicates, they go with the feed
+	deleted, err := db.DeleteMergedFeed(ctx, database.DeleteMergedFeedParams{ID: feed.ID, LeaseOwner: leaseOwner})
+	if err != nil {
+		return fmt.Errorf("couldn't delete the merged feed: %w", err)
+	}
+	if deleted == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// upsertFeedItems saves the items of a feed and their enclosures with one
+// statement each, and queues the deliveries of new posts to webhooks
+func upsertFeedItems(ctx context.Context, db *database.Queries, feed database.Feed, items []RSSItem) (int, error) {
+	now := time.Now().UTC()
+	params, enclosures := postsBatch(feed, items, now)
+	if len(params.Ids) == 0 {
+		return 0, nil
+	}
+	posts, err := db.UpsertPosts(ctx, params)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't save posts: %w", err)
+	}
+
+	// unchanged posts aren't returned, their enclosures are already saved
+	enclosureParams := database.CreatePostEnclosuresParams{}
+	postEnclosures := map[uuid.UUID][]Enclosure{}
+	for _, post := range posts {
+		for _, enclosure := range enclosures[post.ItemKey] {
+			url := strings.TrimSpace(enclosure.URL)
+			if url == "" {
+				continue
+			}
+			// the length is optional and often 0 or garbage, 0 is stored as NULL
+			length, err := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+			if err != nil || length < 0 {
+				length = 0
+			}
+			enclosureParams.Ids = append(enclosureParams.Ids, uuid.New())
+			enclosureParams.PostIds = append(enclosureParams.PostIds, post.ID)
+			enclosureParams.Urls = append(enclosureParams.Urls, url)
+			enclosureParams.Types = append(enclosureParams.Types, strings.TrimSpace(enclosure.Type))
+			enclosureParams.Lengths = append(enclosureParams.Lengths, length)
+			postEnclosures[post.ID] = append(postEnclosures[post.ID], Enclosure{Url: url, Type: strings.TrimSpace(enclosure.Type), Length: length})
+		}
+	}
+	if len(enclosureParams.Ids) > 0 {
+		err = db.CreatePostEnclosures(ctx, enclosureParams)
+		if err != nil {
+			return 0, fmt.Errorf("couldn't save enclosures: %w", err)
+		}
+	}
+
+	// edited posts keep their ID, only new posts have one of the batch
+	newIds := map[uuid.UUID]bool{}
+	for _, id := range params.Ids {
+		newIds[id] = true
+	}
+	newPosts := []Post{}
+	for _, dbPost := range posts {
+		if !newIds[dbPost.ID] {
+			continue
+		}
+		post := databasePostToPost(dbPost)
+		if enclosures, ok := postEnclosures[dbPost.ID]; ok {
+			post.Enclosures = enclosures
+		}
+		newPosts = append(newPosts, post)
+	}
+	err = enqueueWebhookDeliveries(ctx, db, feed, newPosts, now)
+	if err != nil {
+		return 0, err
+	}
+	return len(posts), nil
+}
+
+// postsBatch turns the items of a feed into the parameters of UpsertPosts,
+// along with the enclosures of each item by item key. Items repeating the key
+// of an earlier item are dropped, an upsert can't change a row twice.
+func postsBatch(feed database.Feed, items []RSSItem, now time.Time) (database.UpsertPostsParams, map[string][]RSSEnclosure) {
+	params := database.UpsertPostsParams{
+		CreatedAt: now,
+		FeedID:    feed.ID,
+	}
+	enclosures := map[string][]RSSEnclosure{}
+	for _, item := range items {
+		itemKey := postItemKey(item)
+		if _, ok := enclosures[itemKey]; ok {
+			continue
+		}
+		enclosures[itemKey] = item.Enclosures
+
+		// categories are passed as JSON, see UpsertPosts
+		categories, _ := json.Marshal(itemCategories(item))
+		// fall back to other dates of the item if it has no usable pubDate
+		pubAt, pubAtSource := resolvePublishedAt(item, now)
+
+		params.Ids = append(params.Ids, uuid.New())
+		params.Titles = append(params.Titles, item.Title)
+		params.Urls = append(params.Urls, item.Link)
+		params.PublishedAts = append(params.PublishedAts, pubAt)
+		params.PublishedAtSources = append(params.PublishedAtSources, pubAtSource)
+		params.Descriptions = append(params.Descriptions, strings.TrimSpace(item.Description))
+		params.Contents = append(params.Contents, strings.TrimSpace(item.Content))
+		params.Authors = append(params.Authors, item.ItemAuthor())
+		params.Categories = append(params.Categories, string(categories))
+		params.Guids = append(params.Guids, strings.TrimSpace(item.GUID.Value))
+		params.GuidIsPermalinks = append(params.GuidIsPermalinks, item.GUID.PermaLink())
+		params.CommentsUrls = append(params.CommentsUrls, strings.TrimSpace(item.Comments))
+		params.ItemKeys = append(params.ItemKeys, itemKey)
+		params.ContentHashes = append(params.ContentHashes, postContentHash(item))
+	}
+	return params, enclosures
+}
+
+// itemCategories returns the non-empty categories of an item, never nil
+// as a nil slice would be stored as NULL
+func itemCategories(item RSSItem) []string {
+	categories := []string{}
+	for _, category := range item.Categories {
+		if category = strings.TrimSpace(category); category != "" {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
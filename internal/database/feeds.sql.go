@@ -7,15 +7,92 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET lease_owner=$1::text,
+lease_expires_at=NOW() + $2::int * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM feeds AS due
+    WHERE due.disabled_at IS NULL
+    AND (due.next_fetch_at IS NULL OR due.next_fetch_at <= NOW())
+    AND (due.lease_expires_at IS NULL OR due.lease_expires_at <= NOW())
+    AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = due.id)
+    ORDER BY COALESCE(due.next_fetch_at, '-infinity'::timestamp) ASC, due.last_fetched_at ASC NULLS FIRST
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, name, url, created_at, updated_at, last_fetched_at, etag, last_modified, content_hash, last_error, consecutive_failures, last_success_at, next_fetch_at, disabled_at, refresh_interval_seconds, skip_hours, skip_days, lease_owner, lease_expires_at, gone_at
+`
+
+type ClaimFeedsToFetchParams struct {
+	LeaseOwner   string
+	LeaseSeconds int32
+	Limit        int32
+}
+
+// leases the feeds that are due to the given scraper. Feeds leased by other
+// scrapers are skipped until their lease expires. next_fetch_at is only NULL
+// for feeds that were never fetched, which go first.
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseOwner, arg.LeaseSeconds, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Url,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ContentHash,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.NextFetchAt,
+			&i.DisabledAt,
+			&i.RefreshIntervalSeconds,
+			pq.Array(&i.SkipHours),
+			pq.Array(&i.SkipDays),
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.GoneAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, name, url, created_at, updated_at, user_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at
+INSERT INTO feeds (id, name, url, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (url) DO UPDATE SET url=EXCLUDED.url,
+disabled_at=NULL,
+gone_at=NULL,
+consecutive_failures=CASE WHEN feeds.disabled_at IS NULL THEN feeds.consecutive_failures ELSE 0 END,
+next_fetch_at=CASE WHEN feeds.disabled_at IS NULL THEN feeds.next_fetch_at ELSE NOW() END
+RETURNING id, name, url, created_at, updated_at, last_fetched_at, etag, last_modified, content_hash, last_error, consecutive_failures, last_success_at, next_fetch_at, disabled_at, refresh_interval_seconds, skip_hours, skip_days, lease_owner, lease_expires_at, gone_at
 `
 
 type CreateFeedParams struct {
@@ -24,9 +101,10 @@ type CreateFeedParams struct {
 	Url       string
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	UserID    uuid.UUID
 }
 
+// returns the existing feed if a feed with the URL already exists. A disabled
+// feed is enabled again, as it's followed anew.
 func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
 	row := q.db.QueryRowContext(ctx, createFeed,
 		arg.ID,
@@ -34,7 +112,6 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		arg.Url,
 		arg.CreatedAt,
 		arg.UpdatedAt,
-		arg.UserID,
 	)
 	var i Feed
 	err := row.Scan(
@@ -43,37 +120,94 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+		&i.RefreshIntervalSeconds,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.GoneAt,
 	)
 	return i, err
 }
 
-const deleteFeed = `-- name: DeleteFeed :exec
-DELETE FROM feeds WHERE user_id=$1 AND id=$2
+const deferFeedFetch = `-- name: DeferFeedFetch :exec
+UPDATE feeds
+SET next_fetch_at=$2,
+lease_owner=NULL,
+lease_expires_at=NULL
+WHERE id=$1 AND lease_owner=$3
 `
 
-type DeleteFeedParams struct {
-	UserID uuid.UUID
-	ID     uuid.UUID
+type DeferFeedFetchParams struct {
+	ID          uuid.UUID
+	NextFetchAt sql.NullTime
+	LeaseOwner  sql.NullString
 }
 
-func (q *Queries) DeleteFeed(ctx context.Context, arg DeleteFeedParams) error {
-	_, err := q.db.ExecContext(ctx, deleteFeed, arg.UserID, arg.ID)
+func (q *Queries) DeferFeedFetch(ctx context.Context, arg DeferFeedFetchParams) error {
+	_, err := q.db.ExecContext(ctx, deferFeedFetch, arg.ID, arg.NextFetchAt, arg.LeaseOwner)
 	return err
 }
 
-const getFeedByURL = `-- name: GetFeedByURL :one
-SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at FROM feeds WHERE user_id=$1 AND url=$2
+const deleteMergedFeed = `-- name: DeleteMergedFeed :execrows
+DELETE FROM feeds WHERE id=$1 AND lease_owner=$2::text
 `
 
-type GetFeedByURLParams struct {
+type DeleteMergedFeedParams struct {
+	ID         uuid.UUID
+	LeaseOwner string
+}
+
+// deletes a feed that was merged into another feed, unless the lease on the
+// feed was lost to another scraper in the meantime
+func (q *Queries) DeleteMergedFeed(ctx context.Context, arg DeleteMergedFeedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteMergedFeed, arg.ID, arg.LeaseOwner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const enableFeed = `-- name: EnableFeed :execrows
+UPDATE feeds
+SET disabled_at=NULL,
+gone_at=NULL,
+consecutive_failures=0,
+next_fetch_at=NOW(),
+updated_at=NOW()
+WHERE id=$1
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id AND feed_follows.user_id = $2)
+`
+
+type EnableFeedParams struct {
+	ID     uuid.UUID
 	UserID uuid.UUID
-	Url    string
 }
 
-func (q *Queries) GetFeedByURL(ctx context.Context, arg GetFeedByURLParams) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getFeedByURL, arg.UserID, arg.Url)
+// enables a disabled feed the user follows again, it's fetched right away
+func (q *Queries) EnableFeed(ctx context.Context, arg EnableFeedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableFeed, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getFeedByURL = `-- name: GetFeedByURL :one
+SELECT id, name, url, created_at, updated_at, last_fetched_at, etag, last_modified, content_hash, last_error, consecutive_failures, last_success_at, next_fetch_at, disabled_at, refresh_interval_seconds, skip_hours, skip_days, lease_owner, lease_expires_at, gone_at FROM feeds WHERE url=$1
+`
+
+func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByURL, url)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -81,94 +215,59 @@ func (q *Queries) GetFeedByURL(ctx context.Context, arg GetFeedByURLParams) (Fee
 		&i.Url,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+		&i.RefreshIntervalSeconds,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.GoneAt,
 	)
 	return i, err
 }
 
-const getFeedsOfUser = `-- name: GetFeedsOfUser :many
-SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at FROM feeds WHERE user_id=$1
-`
-
-func (q *Queries) GetFeedsOfUser(ctx context.Context, userID uuid.UUID) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getFeedsOfUser, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Feed
-	for rows.Next() {
-		var i Feed
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Url,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.UserID,
-			&i.LastFetchedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
-SELECT id, name, url, created_at, updated_at, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1
-`
-
-func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, limit)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []Feed
-	for rows.Next() {
-		var i Feed
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Url,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.UserID,
-			&i.LastFetchedAt,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const markFeedAsFetched = `-- name: MarkFeedAsFetched :one
+const markFeedFetchFailed = `-- name: MarkFeedFetchFailed :one
 UPDATE feeds
 SET last_fetched_at=NOW(),
+last_error=$1,
+consecutive_failures=consecutive_failures+1,
+next_fetch_at=$2,
+disabled_at=CASE WHEN $3::bool OR consecutive_failures+1 >= $4::int THEN NOW() ELSE disabled_at END,
+gone_at=CASE WHEN $3::bool THEN NOW() ELSE gone_at END,
+lease_owner=NULL,
+lease_expires_at=NULL,
 updated_at=NOW()
-WHERE id=$1
-RETURNING id, name, url, created_at, updated_at, user_id, last_fetched_at
+WHERE id=$5 AND lease_owner=$6::text
+RETURNING id, name, url, created_at, updated_at, last_fetched_at, etag, last_modified, content_hash, last_error, consecutive_failures, last_success_at, next_fetch_at, disabled_at, refresh_interval_seconds, skip_hours, skip_days, lease_owner, lease_expires_at, gone_at
 `
 
-func (q *Queries) MarkFeedAsFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedAsFetched, id)
+type MarkFeedFetchFailedParams struct {
+	LastError   sql.NullString
+	NextFetchAt sql.NullTime
+	Gone        bool
+	MaxFailures int32
+	ID          uuid.UUID
+	LeaseOwner  string
+}
+
+// returns no rows if the lease on the feed was lost to another scraper
+func (q *Queries) MarkFeedFetchFailed(ctx context.Context, arg MarkFeedFetchFailedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedFetchFailed,
+		arg.LastError,
+		arg.NextFetchAt,
+		arg.Gone,
+		arg.MaxFailures,
+		arg.ID,
+		arg.LeaseOwner,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -176,8 +275,138 @@ func (q *Queries) MarkFeedAsFetched(ctx context.Context, id uuid.UUID) (Feed, er
 		&i.Url,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ContentHash,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.NextFetchAt,
+		&i.DisabledAt,
+		&i.RefreshIntervalSeconds,
+		pq.Array(&i.SkipHours),
+		pq.Array(&i.SkipDays),
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.GoneAt,
 	)
 	return i, err
 }
+
+const markFeedFetchSucceeded = `-- name: MarkFeedFetchSucceeded :execrows
+UPDATE feeds
+SET last_fetched_at=NOW(),
+last_error=NULL,
+consecutive_failures=0,
+last_success_at=NOW(),
+lease_owner=NULL,
+lease_expires_at=NULL,
+next_fetch_at=$1::timestamp,
+updated_at=NOW()
+WHERE id=$2 AND lease_owner=$3::text
+`
+
+type MarkFeedFetchSucceededParams struct {
+	NextFetchAt time.Time
+	ID          uuid.UUID
+	LeaseOwner  string
+}
+
+// saves the outcome of a fetch, unless the lease on the feed was lost to
+// another scraper in the meantime
+func (q *Queries) MarkFeedFetchSucceeded(ctx context.Context, arg MarkFeedFetchSucceededParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markFeedFetchSucceeded, arg.NextFetchAt, arg.ID, arg.LeaseOwner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const releaseFeedLease = `-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner=NULL,
+lease_expires_at=NULL
+WHERE id=$1 AND lease_owner=$2
+`
+
+type ReleaseFeedLeaseParams struct {
+	ID         uuid.UUID
+	LeaseOwner sql.NullString
+}
+
+func (q *Queries) ReleaseFeedLease(ctx context.Context, arg ReleaseFeedLeaseParams) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLease, arg.ID, arg.LeaseOwner)
+	return err
+}
+
+const updateFeedCacheState = `-- name: UpdateFeedCacheState :exec
+UPDATE feeds
+SET etag=$2,
+last_modified=$3,
+content_hash=$4
+WHERE id=$1
+`
+
+type UpdateFeedCacheStateParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+	ContentHash  sql.NullString
+}
+
+func (q *Queries) UpdateFeedCacheState(ctx context.Context, arg UpdateFeedCacheStateParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheState,
+		arg.ID,
+		arg.Etag,
+		arg.LastModified,
+		arg.ContentHash,
+	)
+	return err
+}
+
+const updateFeedRefreshHints = `-- name: UpdateFeedRefreshHints :exec
+UPDATE feeds
+SET refresh_interval_seconds=$2,
+skip_hours=$3,
+skip_days=$4
+WHERE id=$1
+`
+
+type UpdateFeedRefreshHintsParams struct {
+	ID                     uuid.UUID
+	RefreshIntervalSeconds sql.NullInt32
+	SkipHours              []int32
+	SkipDays               []string
+}
+
+func (q *Queries) UpdateFeedRefreshHints(ctx context.Context, arg UpdateFeedRefreshHintsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedRefreshHints,
+		arg.ID,
+		arg.RefreshIntervalSeconds,
+		pq.Array(arg.SkipHours),
+		pq.Array(arg.SkipDays),
+	)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :execrows
+UPDATE feeds
+SET url=$2,
+updated_at=NOW()
+WHERE id=$1 AND NOT EXISTS (SELECT 1 FROM feeds AS other WHERE other.url=$2)
+`
+
+type UpdateFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+// moves a feed to a new URL, unless another feed already has that URL
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateFeedURL, arg.ID, arg.Url)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
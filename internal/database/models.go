@@ -12,23 +12,94 @@ import (
 )
 
 type Feed struct {
-	ID            uuid.UUID
-	Name          string
-	Url           string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                     uuid.UUID
+	Name                   string
+	Url                    string
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	LastFetchedAt          sql.NullTime
+	Etag                   sql.NullString
+	LastModified           sql.NullString
+	ContentHash            sql.NullString
+	LastError              sql.NullString
+	ConsecutiveFailures    int32
+	LastSuccessAt          sql.NullTime
+	NextFetchAt            sql.NullTime
+	DisabledAt             sql.NullTime
+	RefreshIntervalSeconds sql.NullInt32
+	SkipHours              []int32
+	SkipDays               []string
+	LeaseOwner             sql.NullString
+	LeaseExpiresAt         sql.NullTime
+	GoneAt                 sql.NullTime
+}
+
+type FeedFollow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	FeedID    uuid.UUID
+	Name      string
+	FolderID  uuid.NullUUID
+}
+
+type FeedUrlChange struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	FeedID    uuid.UUID
+	OldUrl    string
+	NewUrl    string
+}
+
+type Folder struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Name      string
+}
+
+type OutputFeed struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Token     string
+	Title     string
+	FeedID    uuid.NullUUID
+	FolderID  uuid.NullUUID
+	Tag       sql.NullString
+	Keyword   sql.NullString
 }
 
 type Post struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	PublishedAt       time.Time
+	FeedID            uuid.UUID
+	PublishedAtSource string
+	Description       string
+	Content           string
+	Author            string
+	Categories        []string
+	Guid              string
+	GuidIsPermalink   bool
+	CommentsUrl       string
+	ItemKey           string
+	ContentHash       string
+	EditedAt          sql.NullTime
+}
+
+type PostEnclosure struct {
+	ID     uuid.UUID
+	PostID uuid.UUID
+	Url    string
+	Type   string
+	Length sql.NullInt64
 }
 
 type User struct {
@@ -38,3 +109,48 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+type UserPostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	Read      bool
+	Starred   bool
+	Archived  bool
+	ReadAt    sql.NullTime
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Webhook struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	Url       string
+	Secret    string
+	FeedIds   []uuid.UUID
+	Keywords  []string
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	WebhookID      uuid.UUID
+	PostID         uuid.NullUUID
+	Payload        string
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	DeliveredAt    sql.NullTime
+	LeaseExpiresAt sql.NullTime
+}
+
+type WebhookDeliveryAttempt struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	DeliveryID uuid.UUID
+	StatusCode sql.NullInt32
+	Error      sql.NullString
+	DurationMs int32
+}
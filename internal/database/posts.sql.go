@@ -7,25 +7,52 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING id, created_at, updated_at, title, url, published_at, feed_id
+INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id, published_at_source,
+    description, content, author, categories, guid, guid_is_permalink, comments_url, item_key, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+ON CONFLICT (feed_id, item_key) DO UPDATE SET
+    updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    guid = EXCLUDED.guid,
+    guid_is_permalink = EXCLUDED.guid_is_permalink,
+    comments_url = EXCLUDED.comments_url,
+    content_hash = EXCLUDED.content_hash,
+    edited_at = CASE WHEN posts.content_hash = '' THEN posts.edited_at ELSE EXCLUDED.updated_at END
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING id, created_at, updated_at, title, url, published_at, feed_id, published_at_source, description, content, author, categories, guid, guid_is_permalink, comments_url, item_key, content_hash, edited_at
 `
 
 type CreatePostParams struct {
-	ID          uuid.UUID
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	Title       string
-	Url         string
-	PublishedAt time.Time
-	FeedID      uuid.UUID
+	ID                uuid.UUID
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Title             string
+	Url               string
+	PublishedAt       time.Time
+	FeedID            uuid.UUID
+	PublishedAtSource string
+	Description       string
+	Content           string
+	Author            string
+	Categories        []string
+	Guid              string
+	GuidIsPermalink   bool
+	CommentsUrl       string
+	ItemKey           string
+	ContentHash       string
 }
 
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
@@ -37,6 +64,16 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Url,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.PublishedAtSource,
+		arg.Description,
+		arg.Content,
+		arg.Author,
+		pq.Array(arg.Categories),
+		arg.Guid,
+		arg.GuidIsPermalink,
+		arg.CommentsUrl,
+		arg.ItemKey,
+		arg.ContentHash,
 	)
 	var i Post
 	err := row.Scan(
@@ -47,6 +84,503 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Url,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.PublishedAtSource,
+		&i.Description,
+		&i.Content,
+		&i.Author,
+		pq.Array(&i.Categories),
+		&i.Guid,
+		&i.GuidIsPermalink,
+		&i.CommentsUrl,
+		&i.ItemKey,
+		&i.ContentHash,
+		&i.EditedAt,
 	)
 	return i, err
 }
+
+const createPostEnclosure = `-- name: CreatePostEnclosure :exec
+INSERT INTO post_enclosures (id, post_id, url, type, length)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (post_id, url) DO NOTHING
+`
+
+type CreatePostEnclosureParams struct {
+	ID     uuid.UUID
+	PostID uuid.UUID
+	Url    string
+	Type   string
+	Length sql.NullInt64
+}
+
+func (q *Queries) CreatePostEnclosure(ctx context.Context, arg CreatePostEnclosureParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosure,
+		arg.ID,
+		arg.PostID,
+		arg.Url,
+		arg.Type,
+		arg.Length,
+	)
+	return err
+}
+
+const createPostEnclosures = `-- name: CreatePostEnclosures :exec
+INSERT INTO post_enclosures (id, post_id, url, type, length)
+SELECT i.id, i.post_id, i.url, i.type, NULLIF(i.length, 0)
+FROM unnest(
+    $1::uuid[],
+    $2::uuid[],
+    $3::text[],
+    $4::text[],
+    $5::bigint[]
+) AS i(id, post_id, url, type, length)
+ON CONFLICT (post_id, url) DO NOTHING
+`
+
+type CreatePostEnclosuresParams struct {
+	Ids     []uuid.UUID
+	PostIds []uuid.UUID
+	Urls    []string
+	Types   []string
+	Lengths []int64
+}
+
+func (q *Queries) CreatePostEnclosures(ctx context.Context, arg CreatePostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosures,
+		pq.Array(arg.Ids),
+		pq.Array(arg.PostIds),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Types),
+		pq.Array(arg.Lengths),
+	)
+	return err
+}
+
+const getEnclosuresForPosts = `-- name: GetEnclosuresForPosts :many
+SELECT id, post_id, url, type, length FROM post_enclosures
+WHERE post_id = ANY($1::uuid[])
+ORDER BY post_id, url
+`
+
+func (q *Queries) GetEnclosuresForPosts(ctx context.Context, postIds []uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getEnclosuresForPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.ID,
+			&i.PostID,
+			&i.Url,
+			&i.Type,
+			&i.Length,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForOutputFeed = `-- name: GetPostsForOutputFeed :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.published_at, posts.feed_id, posts.published_at_source, posts.description, posts.content, posts.author, posts.categories, posts.guid, posts.guid_is_permalink, posts.comments_url, posts.item_key, posts.content_hash, posts.edited_at FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1
+AND ($2::uuid IS NULL OR posts.feed_id = $2::uuid)
+AND ($3::uuid IS NULL OR feed_follows.folder_id = $3::uuid)
+AND ($4::text IS NULL
+    OR EXISTS (SELECT 1 FROM unnest(posts.categories) AS category WHERE lower(category) = lower($4::text)))
+AND ($5::text IS NULL
+    OR posts.title ILIKE '%' || $5::text || '%' ESCAPE '\'
+    OR posts.description ILIKE '%' || $5::text || '%' ESCAPE '\')
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT $6
+`
+
+type GetPostsForOutputFeedParams struct {
+	UserID   uuid.UUID
+	FeedID   uuid.NullUUID
+	FolderID uuid.NullUUID
+	Tag      sql.NullString
+	Keyword  sql.NullString
+	Limit    int32
+}
+
+// latest posts of the feeds a user follows, filtered like an output feed
+func (q *Queries) GetPostsForOutputFeed(ctx context.Context, arg GetPostsForOutputFeedParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForOutputFeed,
+		arg.UserID,
+		arg.FeedID,
+		arg.FolderID,
+		arg.Tag,
+		arg.Keyword,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Description,
+			&i.Content,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Guid,
+			&i.GuidIsPermalink,
+			&i.CommentsUrl,
+			&i.ItemKey,
+			&i.ContentHash,
+			&i.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForUser = `-- name: GetPostsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.published_at, posts.feed_id, posts.published_at_source, posts.description, posts.content, posts.author, posts.categories, posts.guid, posts.guid_is_permalink, posts.comments_url, posts.item_key, posts.content_hash, posts.edited_at FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::uuid IS NULL OR posts.feed_id = $2::uuid)
+AND ($3::timestamp IS NULL OR posts.published_at >= $3::timestamp)
+AND ($4::timestamp IS NULL OR posts.published_at < $4::timestamp)
+AND ($5::text IS NULL OR posts.title ILIKE '%' || $5::text || '%' ESCAPE '\')
+AND ($6::bool IS NULL OR COALESCE(user_post_states.read, false) = $6::bool)
+AND ($7::bool IS NULL OR COALESCE(user_post_states.starred, false) = $7::bool)
+AND ($8::bool IS NULL OR COALESCE(user_post_states.archived, false) = $8::bool)
+AND ($9::uuid IS NULL OR feed_follows.folder_id = $9::uuid)
+AND ($10::timestamp IS NULL
+    OR (posts.published_at, posts.id) < ($10::timestamp, $11::uuid))
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT $12
+`
+
+type GetPostsForUserParams struct {
+	UserID            uuid.UUID
+	FeedID            uuid.NullUUID
+	Since             sql.NullTime
+	Until             sql.NullTime
+	Title             sql.NullString
+	Read              sql.NullBool
+	Starred           sql.NullBool
+	Archived          sql.NullBool
+	FolderID          uuid.NullUUID
+	CursorPublishedAt sql.NullTime
+	CursorID          uuid.NullUUID
+	Limit             int32
+}
+
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.Title,
+		arg.Read,
+		arg.Starred,
+		arg.Archived,
+		arg.FolderID,
+		arg.CursorPublishedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Description,
+			&i.Content,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Guid,
+			&i.GuidIsPermalink,
+			&i.CommentsUrl,
+			&i.ItemKey,
+			&i.ContentHash,
+			&i.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostsForUserOldestFirst = `-- name: GetPostsForUserOldestFirst :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.published_at, posts.feed_id, posts.published_at_source, posts.description, posts.content, posts.author, posts.categories, posts.guid, posts.guid_is_permalink, posts.comments_url, posts.item_key, posts.content_hash, posts.edited_at FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::uuid IS NULL OR posts.feed_id = $2::uuid)
+AND ($3::timestamp IS NULL OR posts.published_at >= $3::timestamp)
+AND ($4::timestamp IS NULL OR posts.published_at < $4::timestamp)
+AND ($5::text IS NULL OR posts.title ILIKE '%' || $5::text || '%' ESCAPE '\')
+AND ($6::bool IS NULL OR COALESCE(user_post_states.read, false) = $6::bool)
+AND ($7::bool IS NULL OR COALESCE(user_post_states.starred, false) = $7::bool)
+AND ($8::bool IS NULL OR COALESCE(user_post_states.archived, false) = $8::bool)
+AND ($9::uuid IS NULL OR feed_follows.folder_id = $9::uuid)
+AND ($10::timestamp IS NULL
+    OR (posts.published_at, posts.id) > ($10::timestamp, $11::uuid))
+ORDER BY posts.published_at ASC, posts.id ASC
+LIMIT $12
+`
+
+type GetPostsForUserOldestFirstParams struct {
+	UserID            uuid.UUID
+	FeedID            uuid.NullUUID
+	Since             sql.NullTime
+	Until             sql.NullTime
+	Title             sql.NullString
+	Read              sql.NullBool
+	Starred           sql.NullBool
+	Archived          sql.NullBool
+	FolderID          uuid.NullUUID
+	CursorPublishedAt sql.NullTime
+	CursorID          uuid.NullUUID
+	Limit             int32
+}
+
+func (q *Queries) GetPostsForUserOldestFirst(ctx context.Context, arg GetPostsForUserOldestFirstParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUserOldestFirst,
+		arg.UserID,
+		arg.FeedID,
+		arg.Since,
+		arg.Until,
+		arg.Title,
+		arg.Read,
+		arg.Starred,
+		arg.Archived,
+		arg.FolderID,
+		arg.CursorPublishedAt,
+		arg.CursorID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Description,
+			&i.Content,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Guid,
+			&i.GuidIsPermalink,
+			&i.CommentsUrl,
+			&i.ItemKey,
+			&i.ContentHash,
+			&i.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const movePosts = `-- name: MovePosts :exec
+UPDATE posts
+SET feed_id=$1
+WHERE feed_id=$2
+AND NOT EXISTS (SELECT 1 FROM posts AS other WHERE other.feed_id=$1 AND other.item_key=posts.item_key)
+`
+
+type MovePostsParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+// moves the posts of a feed to another feed, except for the items the other
+// feed has as well
+func (q *Queries) MovePosts(ctx context.Context, arg MovePostsParams) error {
+	_, err := q.db.ExecContext(ctx, movePosts, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
+
+const upsertPosts = `-- name: UpsertPosts :many
+INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id, published_at_source,
+    description, content, author, categories, guid, guid_is_permalink, comments_url, item_key, content_hash)
+SELECT i.id, $1::timestamp, $1::timestamp, i.title, i.url, i.published_at,
+    $2::uuid, i.published_at_source, i.description, i.content, i.author,
+    ARRAY(SELECT jsonb_array_elements_text(i.categories::jsonb)), i.guid, i.guid_is_permalink, i.comments_url,
+    i.item_key, i.content_hash
+FROM unnest(
+    $3::uuid[],
+    $4::text[],
+    $5::text[],
+    $6::timestamp[],
+    $7::text[],
+    $8::text[],
+    $9::text[],
+    $10::text[],
+    $11::text[],
+    $12::text[],
+    $13::boolean[],
+    $14::text[],
+    $15::text[],
+    $16::text[]
+) AS i(id, title, url, published_at, published_at_source, description, content, author, categories,
+    guid, guid_is_permalink, comments_url, item_key, content_hash)
+ON CONFLICT (feed_id, item_key) DO UPDATE SET
+    updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    guid = EXCLUDED.guid,
+    guid_is_permalink = EXCLUDED.guid_is_permalink,
+    comments_url = EXCLUDED.comments_url,
+    content_hash = EXCLUDED.content_hash,
+    edited_at = CASE WHEN posts.content_hash = '' THEN posts.edited_at ELSE EXCLUDED.updated_at END
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING id, created_at, updated_at, title, url, published_at, feed_id, published_at_source, description, content, author, categories, guid, guid_is_permalink, comments_url, item_key, content_hash, edited_at
+`
+
+type UpsertPostsParams struct {
+	CreatedAt          time.Time
+	FeedID             uuid.UUID
+	Ids                []uuid.UUID
+	Titles             []string
+	Urls               []string
+	PublishedAts       []time.Time
+	PublishedAtSources []string
+	Descriptions       []string
+	Contents           []string
+	Authors            []string
+	Categories         []string
+	Guids              []string
+	GuidIsPermalinks   []bool
+	CommentsUrls       []string
+	ItemKeys           []string
+	ContentHashes      []string
+}
+
+// inserts the posts of a feed in one statement, the arrays hold one element per post.
+// Categories are passed as JSON arrays as Postgres has no arrays of arrays.
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		arg.CreatedAt,
+		arg.FeedID,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.PublishedAtSources),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.Contents),
+		pq.Array(arg.Authors),
+		pq.Array(arg.Categories),
+		pq.Array(arg.Guids),
+		pq.Array(arg.GuidIsPermalinks),
+		pq.Array(arg.CommentsUrls),
+		pq.Array(arg.ItemKeys),
+		pq.Array(arg.ContentHashes),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.PublishedAtSource,
+			&i.Description,
+			&i.Content,
+			&i.Author,
+			pq.Array(&i.Categories),
+			&i.Guid,
+			&i.GuidIsPermalink,
+			&i.CommentsUrl,
+			&i.ItemKey,
+			&i.ContentHash,
+			&i.EditedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
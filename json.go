@@ -2,13 +2,13 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
 	if code > 499 {
-		log.Println("Responding with 5XX error", msg)
+		slog.Error("Responding with 5XX error", "error", msg)
 	}
 	type errResponse struct {
 		Error string `json:"error"`
@@ -21,7 +21,7 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Failed to marshal JSON response: %v", err)
+		slog.Error("Failed to marshal JSON response", "error", err)
 		w.WriteHeader(500)
 		return
 	}
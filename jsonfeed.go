@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerFeedParser(feedParser{
+		name:         "JSON Feed",
+		contentTypes: []string{"application/feed+json"},
+		sniff:        isJSONFeed,
+		parse:        parseJSONFeed,
+	})
+}
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	// the spec requires a string, but some publishers use numbers
+	ID            json.RawMessage      `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Tags          []string             `json:"tags"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+	// authors replaced author in JSON Feed 1.1
+	Authors []JSONFeedAuthor `json:"authors"`
+	Author  *JSONFeedAuthor  `json:"author"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type JSONFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+}
+
+// isJSONFeed reports whether the document is a JSON object declaring
+// a JSON Feed version
+func isJSONFeed(dat []byte) bool {
+	dat = bytes.TrimLeft(dat, "\ufeff \t\r\n")
+	if len(dat) == 0 || dat[0] != '{' {
+		return false
+	}
+	header := struct {
+		Version string `json:"version"`
+	}{}
+	if err := json.Unmarshal(dat, &header); err != nil {
+		return false
+	}
+	return strings.Contains(header.Version, "jsonfeed.org/version/")
+}
+
+func parseJSONFeed(dat []byte) (RSSFeed, error) {
+	jsonFeed := JSONFeed{}
+	err := json.Unmarshal(bytes.TrimPrefix(dat, []byte("\ufeff")), &jsonFeed)
+	if err != nil {
+		return RSSFeed{}, err
+	}
+
+	// normalize the JSON Feed into the RSS shape used by the scraper
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = jsonFeed.Title
+	rssFeed.Channel.Link = jsonFeed.HomePageURL
+	for _, item := range jsonFeed.Items {
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		content := item.ContentHTML
+		if content == "" {
+			content = item.ContentText
+		}
+		rssItem := RSSItem{
+			Title:       item.Title,
+			Link:        link,
+			PubDate:     item.DatePublished,
+			GUID:        RSSGUID{Value: jsonFeedItemID(item.ID), IsPermaLink: "false"},
+			Updated:     item.DateModified,
+			Description: item.Summary,
+			Content:     content,
+			Categories:  item.Tags,
+		}
+		if item.Author != nil {
+			item.Authors = append(item.Authors, *item.Author)
+		}
+		for _, author := range item.Authors {
+			if author.Name != "" {
+				rssItem.Creator = author.Name
+				break
+			}
+		}
+		for _, attachment := range item.Attachments {
+			enclosure := RSSEnclosure{URL: attachment.URL, Type: attachment.MimeType}
+			if attachment.SizeInBytes > 0 {
+				enclosure.Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+			}
+			rssItem.Enclosures = append(rssItem.Enclosures, enclosure)
+		}
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, rssItem)
+	}
+	return rssFeed, nil
+}
+
+func jsonFeedItemID(raw json.RawMessage) string {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return id
+	}
+	return string(raw)
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"embed"
-	"fmt"
+	"errors"
+	"expvar"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -19,53 +24,91 @@ import (
 // for connection to DB
 type apiConfig struct {
 	DB *database.Queries
+	// connection the queries run on, for handlers that need transactions
+	Conn *sql.DB
+	// fetcher of the scraper, which also checks user-supplied feed URLs
+	Fetcher *feedFetcher
+	// URL clients reach the service at, see config
+	PublicURL         string
+	TrustProxyHeaders bool
 }
 
 //go:embed sql/schema/*.sql
 var embedMigrations embed.FS
 
+// time given to in-flight requests, scrapes and deliveries to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// root context, cancelled on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Get DB password
-	bin, err := os.ReadFile("/run/secrets/db-password")
+	// load config from file, environment and flags
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Fatal("Couldn't get DB password:", err)
+		log.Fatal("Invalid config: ", err)
 	}
+	level, _ := cfg.slogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
 
 	// Connect to DB
-	conn, err := sql.Open("postgres", fmt.Sprintf("postgres://postgres:%s@db:5432/scraperss?sslmode=disable", string(bin)))
+	dsn, err := cfg.dsn()
+	if err != nil {
+		fatal("Couldn't get DB connection URL", err)
+	}
+	conn, err := sql.Open("postgres", dsn)
 	if err != nil {
-		log.Fatal("Couldn't connect to DB:", err)
+		fatal("Couldn't connect to DB", err)
 	}
+	defer conn.Close()
 
 	// run goose migrations
 	goose.SetBaseFS(embedMigrations)
 
 	err = goose.SetDialect("postgres")
 	if err != nil {
-		log.Fatal("Couldn't set dialect for goose:", err)
+		fatal("Couldn't set dialect for goose", err)
 	}
 
-	err = goose.Up(conn, "sql/schema")
+	err = goose.UpContext(ctx, conn, "sql/schema")
 	if err != nil {
-		log.Fatal("Couldn't run goose migrations:", err)
+		fatal("Couldn't run goose migrations", err)
 	}
 
 	db := database.New(conn)
 
+	// a single fetcher is shared by all scrapes
+	fetcher := newFeedFetcher(cfg.Scraper)
+
 	// DB Config
 	apiCfg := apiConfig{
-		DB: db,
+		DB:                db,
+		Conn:              conn,
+		Fetcher:           fetcher,
+		PublicURL:         cfg.PublicURL,
+		TrustProxyHeaders: cfg.TrustProxyHeaders,
 	}
 
-	// start scraping 10 feeds in parallel every 1 minute
-	go startScraping(db, 10, time.Minute)
+	// start scraping feeds in parallel
+	scraperDone := make(chan struct{})
+	go func() {
+		defer close(scraperDone)
+		startScraping(ctx, conn, fetcher, cfg.Scraper, shutdownTimeout)
+	}()
+
+	// send new posts to webhooks, retrying failed deliveries
+	deliveriesDone := make(chan struct{})
+	go func() {
+		defer close(deliveriesDone)
+		startDelivering(ctx, conn, fetcher, cfg.Scraper.UserAgent)
+	}()
 
 	// create router
 	router := chi.NewRouter()
 	// CORS configurations
 	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
+		AllowedOrigins:   cfg.CORSOrigins,
 		AllowedMethods:   []string{"POST", "GET", "PUT", "DELETE"},
 		AllowedHeaders:   []string{"*"},
 		ExposedHeaders:   []string{"Link"},
@@ -89,20 +132,86 @@ func main() {
 	// feeds endpoints (authorized)
 	v1Router.Post("/feeds", apiCfg.middlewareAuthzHandler(apiCfg.handlerCreateFeed))
 	v1Router.Get("/feeds", apiCfg.middlewareAuthzHandler(apiCfg.handlerGetFeeds))
+	v1Router.Post("/feeds/discover", apiCfg.middlewareAuthzHandler(apiCfg.handlerDiscoverFeeds))
+	v1Router.Post("/feeds/import", apiCfg.middlewareAuthzHandler(apiCfg.handlerImportFeeds))
+	v1Router.Get("/feeds/export", apiCfg.middlewareAuthzHandler(apiCfg.handlerExportFeeds))
 	v1Router.Delete("/feeds/{feedID}", apiCfg.middlewareAuthzHandler(apiCfg.handlerDeleteFeed))
+	v1Router.Post("/feeds/{feedID}/enable", apiCfg.middlewareAuthzHandler(apiCfg.handlerEnableFeed))
+	v1Router.Put("/feeds/{feedID}/folder", apiCfg.middlewareAuthzHandler(apiCfg.handlerMoveFeedToFolder))
+
+	// folders endpoints (authorized)
+	v1Router.Post("/folders", apiCfg.middlewareAuthzHandler(apiCfg.handlerCreateFolder))
+	v1Router.Get("/folders", apiCfg.middlewareAuthzHandler(apiCfg.handlerGetFolders))
+	v1Router.Put("/folders/{folderID}", apiCfg.middlewareAuthzHandler(apiCfg.handlerRenameFolder))
+	v1Router.Delete("/folders/{folderID}", apiCfg.middlewareAuthzHandler(apiCfg.handlerDeleteFolder))
+
+	// posts endpoints (authorized)
+	v1Router.Get("/posts", apiCfg.middlewareAuthzHandler(apiCfg.handlerGetPosts))
+	v1Router.Post("/posts/read", apiCfg.middlewareAuthzHandler(apiCfg.handlerMarkPostsRead))
+	v1Router.Put("/posts/{postID}/state", apiCfg.middlewareAuthzHandler(apiCfg.handlerUpdatePostState))
+
+	// output feeds endpoints (authorized)
+	v1Router.Post("/output-feeds", apiCfg.middlewareAuthzHandler(apiCfg.handlerCreateOutputFeed))
+	v1Router.Get("/output-feeds", apiCfg.middlewareAuthzHandler(apiCfg.handlerGetOutputFeeds))
+	v1Router.Delete("/output-feeds/{outputFeedID}", apiCfg.middlewareAuthzHandler(apiCfg.handlerDeleteOutputFeed))
+
+	// webhooks endpoints (authorized)
+	v1Router.Post("/webhooks", apiCfg.middlewareAuthzHandler(apiCfg.handlerCreateWebhook))
+	v1Router.Get("/webhooks", apiCfg.middlewareAuthzHandler(apiCfg.handlerGetWebhooks))
+	v1Router.Delete("/webhooks/{webhookID}", apiCfg.middlewareAuthzHandler(apiCfg.handlerDeleteWebhook))
+	v1Router.Get("/webhooks/{webhookID}/deliveries", apiCfg.middlewareAuthzHandler(apiCfg.handlerGetWebhookDeliveries))
+	v1Router.Post("/webhooks/{webhookID}/deliveries/{deliveryID}/redeliver", apiCfg.middlewareAuthzHandler(apiCfg.handlerRedeliverWebhookDelivery))
+
+	// output feeds, authorized by the token in their URL
+	v1Router.Get("/output/{token}/{format}", apiCfg.handlerServeOutputFeed)
 
 	// mount v1 router to the main router
 	router.Mount("/v1", v1Router)
 
+	// metrics of the service, e.g. the depth of the scraper's queue
+	router.Get("/debug/vars", expvar.Handler().ServeHTTP)
+
 	// create server
 	srv := http.Server{
+		Addr:    cfg.ListenAddr,
 		Handler: router,
 	}
 
 	// run service and catch error
-	log.Printf("Starting server on port 80")
-	err = srv.ListenAndServe()
+	go func() {
+		slog.Info("Starting server", "addr", cfg.ListenAddr)
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("Couldn't start server", err)
+		}
+	}()
+
+	// wait for a shutdown signal, then let in-flight requests, scrapes
+	// and deliveries finish before exiting
+	<-ctx.Done()
+	stop()
+	slog.Info("Shutting down, waiting for in-flight work", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err = srv.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal("Couldn't start server:", err)
+		slog.Error("Couldn't shut down server gracefully", "error", err)
+	}
+	select {
+	case <-scraperDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Scraper didn't finish in time")
+	}
+	select {
+	case <-deliveriesDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Webhook deliveries didn't finish in time")
 	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error regardless of the log level and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
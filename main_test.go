@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 )
@@ -14,6 +17,45 @@ const healthzEndpoint = "http://localhost:80/v1/healthz"
 const errorEndpoint = "http://localhost:80/v1/err"
 const usersEndpoint = "http://localhost:80/v1/users"
 const feedsEndpoint = "http://localhost:80/v1/feeds"
+const postsEndpoint = "http://localhost:80/v1/posts"
+const foldersEndpoint = "http://localhost:80/v1/folders"
+const outputFeedsEndpoint = "http://localhost:80/v1/output-feeds"
+const webhooksEndpoint = "http://localhost:80/v1/webhooks"
+
+// testFeedHost returns the name the service reaches the host running the
+// tests by, which must be on its SCRAPER_ALLOWED_HOSTS. It defaults to the
+// name given to the host in compose.test.yaml.
+func testFeedHost() string {
+	if host := os.Getenv("TEST_FEED_HOST"); host != "" {
+		return host
+	}
+	return "host.docker.internal"
+}
+
+// startTestFeedServer serves the sample RSS feed to the service, so that
+// following feeds doesn't depend on the network. It returns the URL of the
+// feed at path, which is closed along with the server at the end of the test.
+func startTestFeedServer(t *testing.T, path string) string {
+	dat, err := os.ReadFile("testdata/rss2.xml")
+	if err != nil {
+		t.Fatalf("Failed to read sample feed: %v", err)
+	}
+	// the service runs on another host, so the server listens on all interfaces
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen for the test feed server: %v", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write(dat)
+	}))
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return "http://" + net.JoinHostPort(testFeedHost(), port) + path
+}
 
 func cleanUp(userId string) {
 	// cleanup by deleting the created test user from DB
@@ -178,10 +220,11 @@ func TestCreateFeed(t *testing.T) {
 	apiKey := jsonRespUser["apiKey"]
 	authzVal := "ApiKey " + apiKey
 	// create a feed with user's API key
-	var jsonReqFeed = []byte(`{
+	feedURL := startTestFeedServer(t, "/testcreatefeed")
+	jsonReqFeed, _ := json.Marshal(map[string]string{
 		"name": "Test User's Test Feed",
-		"url": "https://test.com/testcreatefeed"
-	}`)
+		"url":  feedURL,
+	})
 	httpFeedReq, err := http.NewRequest("POST", feedsEndpoint, bytes.NewBuffer(jsonReqFeed))
 	if err != nil {
 		log.Printf("Error creating request for create feed test: %v", err)
@@ -231,10 +274,11 @@ func TestDeleteFeed(t *testing.T) {
 	apiKey := jsonRespUser["apiKey"]
 	authzVal := "ApiKey " + apiKey
 	// create a feed with user's API key
-	var jsonReqFeed = []byte(`{
+	feedURL := startTestFeedServer(t, "/testdeletefeed")
+	jsonReqFeed, _ := json.Marshal(map[string]string{
 		"name": "Test User's Test Feed for deletion",
-		"url": "https://test.com/testdeletefeed"
-	}`)
+		"url":  feedURL,
+	})
 	httpFeedReq, err := http.NewRequest("POST", feedsEndpoint, bytes.NewBuffer(jsonReqFeed))
 	if err != nil {
 		log.Printf("Error creating request for create feed test: %v", err)
@@ -277,3 +321,578 @@ func TestDeleteFeed(t *testing.T) {
 	// cleanup
 	cleanUp(userId)
 }
+
+func TestGetPosts(t *testing.T) {
+	// create HTTP client to send a request
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	// create a user first
+	var jsonReqUser = []byte(`{
+		"name": "Test User for Get Posts Test"
+	}`)
+	resp, err := client.Post(usersEndpoint, "application/json", bytes.NewBuffer(jsonReqUser))
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", usersEndpoint)
+	}
+	// check if the user was created
+	if resp.StatusCode != 201 {
+		log.Printf("Test user not created, got: %v want: 201", resp.StatusCode)
+	}
+	// read user ID and API key from the response body
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading create user response: %v", err)
+	}
+	var jsonRespUser map[string]string
+	err = json.Unmarshal(dat, &jsonRespUser)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	userId := jsonRespUser["id"]
+	apiKey := jsonRespUser["apiKey"]
+	authzVal := "ApiKey " + apiKey
+	// get the first page of posts, newest first
+	postsReq, err := http.NewRequest("GET", postsEndpoint+"?sort=newest&limit=5", nil)
+	if err != nil {
+		log.Printf("Error creating request for get posts test: %v", err)
+	}
+	postsReq.Header.Set("Authorization", authzVal)
+	postsResp, err := client.Do(postsReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", postsEndpoint)
+	}
+	// check for correct response status code
+	if postsResp.StatusCode != 200 {
+		t.Errorf("Failed to get correct response, got: %v want: 200", postsResp.StatusCode)
+	}
+	// an invalid sort order should be rejected
+	badReq, err := http.NewRequest("GET", postsEndpoint+"?sort=random", nil)
+	if err != nil {
+		log.Printf("Error creating request for get posts test: %v", err)
+	}
+	badReq.Header.Set("Authorization", authzVal)
+	badResp, err := client.Do(badReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", postsEndpoint)
+	}
+	if badResp.StatusCode != 400 {
+		t.Errorf("Failed to get correct response, got: %v want: 400", badResp.StatusCode)
+	}
+	// cleanup
+	cleanUp(userId)
+}
+
+func TestPostState(t *testing.T) {
+	// create HTTP client to send a request
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	// create a user first
+	var jsonReqUser = []byte(`{
+		"name": "Test User for Post State Test"
+	}`)
+	resp, err := client.Post(usersEndpoint, "application/json", bytes.NewBuffer(jsonReqUser))
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", usersEndpoint)
+	}
+	// check if the user was created
+	if resp.StatusCode != 201 {
+		log.Printf("Test user not created, got: %v want: 201", resp.StatusCode)
+	}
+	// read user ID and API key from the response body
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading create user response: %v", err)
+	}
+	var jsonRespUser map[string]string
+	err = json.Unmarshal(dat, &jsonRespUser)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	userId := jsonRespUser["id"]
+	apiKey := jsonRespUser["apiKey"]
+	authzVal := "ApiKey " + apiKey
+	// mark all posts published before a time as read
+	markReq, err := http.NewRequest("POST", postsEndpoint+"/read", bytes.NewBuffer([]byte(`{
+		"before": "2024-01-01T00:00:00Z"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for post state test: %v", err)
+	}
+	markReq.Header.Set("Authorization", authzVal)
+	markResp, err := client.Do(markReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", postsEndpoint+"/read")
+	}
+	if markResp.StatusCode != 200 {
+		t.Errorf("Failed to get correct response, got: %v want: 200", markResp.StatusCode)
+	}
+	// posts of feeds the user doesn't follow have no state for the user
+	stateReq, err := http.NewRequest("PUT", postsEndpoint+"/00000000-0000-0000-0000-000000000000/state", bytes.NewBuffer([]byte(`{
+		"read": true
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for post state test: %v", err)
+	}
+	stateReq.Header.Set("Authorization", authzVal)
+	stateResp, err := client.Do(stateReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", postsEndpoint)
+	}
+	if stateResp.StatusCode != 404 {
+		t.Errorf("Failed to get correct response, got: %v want: 404", stateResp.StatusCode)
+	}
+	// unread posts can be listed
+	unreadReq, err := http.NewRequest("GET", postsEndpoint+"?read=false&starred=true", nil)
+	if err != nil {
+		log.Printf("Error creating request for post state test: %v", err)
+	}
+	unreadReq.Header.Set("Authorization", authzVal)
+	unreadResp, err := client.Do(unreadReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", postsEndpoint)
+	}
+	if unreadResp.StatusCode != 200 {
+		t.Errorf("Failed to get correct response, got: %v want: 200", unreadResp.StatusCode)
+	}
+	// cleanup
+	cleanUp(userId)
+}
+
+func TestFolders(t *testing.T) {
+	// create HTTP client to send a request
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	// create a user first
+	var jsonReqUser = []byte(`{
+		"name": "Test User for Folders Test"
+	}`)
+	resp, err := client.Post(usersEndpoint, "application/json", bytes.NewBuffer(jsonReqUser))
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", usersEndpoint)
+	}
+	// check if the user was created
+	if resp.StatusCode != 201 {
+		log.Printf("Test user not created, got: %v want: 201", resp.StatusCode)
+	}
+	// read user ID and API key from the response body
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading create user response: %v", err)
+	}
+	var jsonRespUser map[string]string
+	err = json.Unmarshal(dat, &jsonRespUser)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	userId := jsonRespUser["id"]
+	apiKey := jsonRespUser["apiKey"]
+	authzVal := "ApiKey " + apiKey
+	// create a folder
+	createReq, err := http.NewRequest("POST", foldersEndpoint, bytes.NewBuffer([]byte(`{
+		"name": "News"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for folders test: %v", err)
+	}
+	createReq.Header.Set("Authorization", authzVal)
+	createResp, err := client.Do(createReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", foldersEndpoint)
+	}
+	defer createResp.Body.Close()
+	if createResp.StatusCode != 201 {
+		t.Fatalf("Failed to get correct response, got: %v want: 201", createResp.StatusCode)
+	}
+	dat, err = io.ReadAll(createResp.Body)
+	if err != nil {
+		log.Printf("Error reading create folder response: %v", err)
+	}
+	var jsonRespFolder map[string]any
+	err = json.Unmarshal(dat, &jsonRespFolder)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	folderId, _ := jsonRespFolder["id"].(string)
+	// folder names are unique per user
+	dupReq, err := http.NewRequest("POST", foldersEndpoint, bytes.NewBuffer([]byte(`{
+		"name": "News"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for folders test: %v", err)
+	}
+	dupReq.Header.Set("Authorization", authzVal)
+	dupResp, err := client.Do(dupReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", foldersEndpoint)
+	}
+	if dupResp.StatusCode != 400 {
+		t.Errorf("Failed to get correct response, got: %v want: 400", dupResp.StatusCode)
+	}
+	// posts can be listed per folder
+	postsReq, err := http.NewRequest("GET", postsEndpoint+"?folder_id="+folderId, nil)
+	if err != nil {
+		log.Printf("Error creating request for folders test: %v", err)
+	}
+	postsReq.Header.Set("Authorization", authzVal)
+	postsResp, err := client.Do(postsReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", postsEndpoint)
+	}
+	if postsResp.StatusCode != 200 {
+		t.Errorf("Failed to get correct response, got: %v want: 200", postsResp.StatusCode)
+	}
+	// delete the folder
+	delReq, err := http.NewRequest("DELETE", foldersEndpoint+"/"+folderId, nil)
+	if err != nil {
+		log.Printf("Error creating request for folders test: %v", err)
+	}
+	delReq.Header.Set("Authorization", authzVal)
+	delResp, err := client.Do(delReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", foldersEndpoint)
+	}
+	if delResp.StatusCode != 204 {
+		t.Errorf("Failed to get correct response, got: %v want: 204", delResp.StatusCode)
+	}
+	// cleanup
+	cleanUp(userId)
+}
+
+func TestImportExportFeeds(t *testing.T) {
+	// create HTTP client to send a request
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	// create a user first
+	var jsonReqUser = []byte(`{
+		"name": "Test User for OPML Test"
+	}`)
+	resp, err := client.Post(usersEndpoint, "application/json", bytes.NewBuffer(jsonReqUser))
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", usersEndpoint)
+	}
+	// check if the user was created
+	if resp.StatusCode != 201 {
+		log.Printf("Test user not created, got: %v want: 201", resp.StatusCode)
+	}
+	// read user ID and API key from the response body
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading create user response: %v", err)
+	}
+	var jsonRespUser map[string]string
+	err = json.Unmarshal(dat, &jsonRespUser)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	userId := jsonRespUser["id"]
+	apiKey := jsonRespUser["apiKey"]
+	authzVal := "ApiKey " + apiKey
+	// import a document whose only feed points into a private network
+	importReq, err := http.NewRequest("POST", feedsEndpoint+"/import", bytes.NewBuffer([]byte(`<?xml version="1.0"?>
+	<opml version="2.0">
+		<body>
+			<outline text="Private">
+				<outline text="Local feed" type="rss" xmlUrl="http://localhost/feed"/>
+			</outline>
+		</body>
+	</opml>`)))
+	if err != nil {
+		log.Printf("Error creating request for OPML test: %v", err)
+	}
+	importReq.Header.Set("Authorization", authzVal)
+	importReq.Header.Set("Content-Type", "text/x-opml")
+	importResp, err := client.Do(importReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", feedsEndpoint+"/import")
+	}
+	defer importResp.Body.Close()
+	if importResp.StatusCode != 200 {
+		t.Fatalf("Failed to get correct response, got: %v want: 200", importResp.StatusCode)
+	}
+	dat, err = io.ReadAll(importResp.Body)
+	if err != nil {
+		log.Printf("Error reading import response: %v", err)
+	}
+	var jsonRespImport map[string]any
+	err = json.Unmarshal(dat, &jsonRespImport)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	if jsonRespImport["invalid"] != float64(1) || jsonRespImport["created"] != float64(0) {
+		t.Errorf("Wrong import report, got: %s", dat)
+	}
+	// export the feeds of the user
+	exportReq, err := http.NewRequest("GET", feedsEndpoint+"/export", nil)
+	if err != nil {
+		log.Printf("Error creating request for OPML test: %v", err)
+	}
+	exportReq.Header.Set("Authorization", authzVal)
+	exportResp, err := client.Do(exportReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", feedsEndpoint+"/export")
+	}
+	if exportResp.StatusCode != 200 {
+		t.Errorf("Failed to get correct response, got: %v want: 200", exportResp.StatusCode)
+	}
+	// cleanup
+	cleanUp(userId)
+}
+
+func TestOutputFeeds(t *testing.T) {
+	// create HTTP client to send a request
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	// create a user first
+	var jsonReqUser = []byte(`{
+		"name": "Test User for Output Feeds Test"
+	}`)
+	resp, err := client.Post(usersEndpoint, "application/json", bytes.NewBuffer(jsonReqUser))
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", usersEndpoint)
+	}
+	// check if the user was created
+	if resp.StatusCode != 201 {
+		log.Printf("Test user not created, got: %v want: 201", resp.StatusCode)
+	}
+	// read user ID and API key from the response body
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading create user response: %v", err)
+	}
+	var jsonRespUser map[string]string
+	err = json.Unmarshal(dat, &jsonRespUser)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	userId := jsonRespUser["id"]
+	apiKey := jsonRespUser["apiKey"]
+	authzVal := "ApiKey " + apiKey
+	// create an output feed
+	createReq, err := http.NewRequest("POST", outputFeedsEndpoint, bytes.NewBuffer([]byte(`{
+		"title": "Test output feed",
+		"tag": "go"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for output feeds test: %v", err)
+	}
+	createReq.Header.Set("Authorization", authzVal)
+	createResp, err := client.Do(createReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", outputFeedsEndpoint)
+	}
+	defer createResp.Body.Close()
+	if createResp.StatusCode != 201 {
+		t.Fatalf("Failed to get correct response, got: %v want: 201", createResp.StatusCode)
+	}
+	dat, err = io.ReadAll(createResp.Body)
+	if err != nil {
+		log.Printf("Error reading create output feed response: %v", err)
+	}
+	var jsonRespOutputFeed struct {
+		Urls map[string]string `json:"urls"`
+	}
+	err = json.Unmarshal(dat, &jsonRespOutputFeed)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	// the output feed is served without an API key
+	for format, url := range jsonRespOutputFeed.Urls {
+		feedResp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Failed to get a response from endpoint %v", url)
+		}
+		if feedResp.StatusCode != 200 {
+			t.Errorf("Failed to get correct response for %v, got: %v want: 200", format, feedResp.StatusCode)
+		}
+	}
+	// unknown tokens are not found
+	unknownResp, err := client.Get("http://localhost:80/v1/output/unknown/rss")
+	if err != nil {
+		t.Fatalf("Failed to get a response from the output feed endpoint")
+	}
+	if unknownResp.StatusCode != 404 {
+		t.Errorf("Failed to get correct response, got: %v want: 404", unknownResp.StatusCode)
+	}
+	// the folder of an output feed can't be deleted
+	folderReq, err := http.NewRequest("POST", foldersEndpoint, bytes.NewBuffer([]byte(`{
+		"name": "Output folder"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for output feeds test: %v", err)
+	}
+	folderReq.Header.Set("Authorization", authzVal)
+	folderResp, err := client.Do(folderReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", foldersEndpoint)
+	}
+	defer folderResp.Body.Close()
+	dat, err = io.ReadAll(folderResp.Body)
+	if err != nil {
+		log.Printf("Error reading create folder response: %v", err)
+	}
+	var jsonRespFolder map[string]any
+	err = json.Unmarshal(dat, &jsonRespFolder)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	folderId, _ := jsonRespFolder["id"].(string)
+	folderOutputReq, err := http.NewRequest("POST", outputFeedsEndpoint, bytes.NewBuffer([]byte(`{
+		"title": "Test output feed of a folder",
+		"folderId": "`+folderId+`"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for output feeds test: %v", err)
+	}
+	folderOutputReq.Header.Set("Authorization", authzVal)
+	folderOutputResp, err := client.Do(folderOutputReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", outputFeedsEndpoint)
+	}
+	if folderOutputResp.StatusCode != 201 {
+		t.Errorf("Failed to get correct response, got: %v want: 201", folderOutputResp.StatusCode)
+	}
+	delFolderReq, err := http.NewRequest("DELETE", foldersEndpoint+"/"+folderId, nil)
+	if err != nil {
+		log.Printf("Error creating request for output feeds test: %v", err)
+	}
+	delFolderReq.Header.Set("Authorization", authzVal)
+	delFolderResp, err := client.Do(delFolderReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", foldersEndpoint)
+	}
+	if delFolderResp.StatusCode != 409 {
+		t.Errorf("Failed to get correct response, got: %v want: 409", delFolderResp.StatusCode)
+	}
+	// cleanup
+	cleanUp(userId)
+}
+
+func TestWebhooks(t *testing.T) {
+	// create HTTP client to send a request
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	// create a user first
+	var jsonReqUser = []byte(`{
+		"name": "Test User for Webhooks Test"
+	}`)
+	resp, err := client.Post(usersEndpoint, "application/json", bytes.NewBuffer(jsonReqUser))
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", usersEndpoint)
+	}
+	// check if the user was created
+	if resp.StatusCode != 201 {
+		log.Printf("Test user not created, got: %v want: 201", resp.StatusCode)
+	}
+	// read user ID and API key from the response body
+	defer resp.Body.Close()
+	dat, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Printf("Error reading create user response: %v", err)
+	}
+	var jsonRespUser map[string]string
+	err = json.Unmarshal(dat, &jsonRespUser)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	userId := jsonRespUser["id"]
+	apiKey := jsonRespUser["apiKey"]
+	authzVal := "ApiKey " + apiKey
+	// webhooks in the internal network are refused
+	internalReq, err := http.NewRequest("POST", webhooksEndpoint, bytes.NewBuffer([]byte(`{
+		"url": "http://169.254.169.254/latest/"
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for webhooks test: %v", err)
+	}
+	internalReq.Header.Set("Authorization", authzVal)
+	internalResp, err := client.Do(internalReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", webhooksEndpoint)
+	}
+	if internalResp.StatusCode != 400 {
+		t.Errorf("Failed to get correct response, got: %v want: 400", internalResp.StatusCode)
+	}
+	// create a webhook
+	createReq, err := http.NewRequest("POST", webhooksEndpoint, bytes.NewBuffer([]byte(`{
+		"url": "https://example.com/hooks/scraperss",
+		"keywords": ["go"]
+	}`)))
+	if err != nil {
+		log.Printf("Error creating request for webhooks test: %v", err)
+	}
+	createReq.Header.Set("Authorization", authzVal)
+	createResp, err := client.Do(createReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", webhooksEndpoint)
+	}
+	defer createResp.Body.Close()
+	if createResp.StatusCode != 201 {
+		t.Fatalf("Failed to get correct response, got: %v want: 201", createResp.StatusCode)
+	}
+	dat, err = io.ReadAll(createResp.Body)
+	if err != nil {
+		log.Printf("Error reading create webhook response: %v", err)
+	}
+	var jsonRespWebhook map[string]any
+	err = json.Unmarshal(dat, &jsonRespWebhook)
+	if err != nil {
+		log.Printf("Failed to unmarshal response body: %v", err)
+	}
+	// the secret is only returned on creation
+	if secret, _ := jsonRespWebhook["secret"].(string); secret == "" {
+		t.Errorf("Webhook created without a secret")
+	}
+	webhookId, _ := jsonRespWebhook["id"].(string)
+	// the webhook has no deliveries yet
+	deliveriesReq, err := http.NewRequest("GET", webhooksEndpoint+"/"+webhookId+"/deliveries", nil)
+	if err != nil {
+		log.Printf("Error creating request for webhooks test: %v", err)
+	}
+	deliveriesReq.Header.Set("Authorization", authzVal)
+	deliveriesResp, err := client.Do(deliveriesReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", webhooksEndpoint)
+	}
+	if deliveriesResp.StatusCode != 200 {
+		t.Errorf("Failed to get correct response, got: %v want: 200", deliveriesResp.StatusCode)
+	}
+	// unknown deliveries can't be redelivered
+	redeliverReq, err := http.NewRequest("POST", webhooksEndpoint+"/"+webhookId+"/deliveries/00000000-0000-0000-0000-000000000000/redeliver", nil)
+	if err != nil {
+		log.Printf("Error creating request for webhooks test: %v", err)
+	}
+	redeliverReq.Header.Set("Authorization", authzVal)
+	redeliverResp, err := client.Do(redeliverReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", webhooksEndpoint)
+	}
+	if redeliverResp.StatusCode != 404 {
+		t.Errorf("Failed to get correct response, got: %v want: 404", redeliverResp.StatusCode)
+	}
+	// delete the webhook
+	delReq, err := http.NewRequest("DELETE", webhooksEndpoint+"/"+webhookId, nil)
+	if err != nil {
+		log.Printf("Error creating request for webhooks test: %v", err)
+	}
+	delReq.Header.Set("Authorization", authzVal)
+	delResp, err := client.Do(delReq)
+	if err != nil {
+		t.Fatalf("Failed to get a response from endpoint %v", webhooksEndpoint)
+	}
+	if delResp.StatusCode != 204 {
+		t.Errorf("Failed to get correct response, got: %v want: 204", delResp.StatusCode)
+	}
+	// cleanup
+	cleanUp(userId)
+}
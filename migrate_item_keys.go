@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"github.com/pressly/goose/v3"
+)
+
+// Migration 011 keyed the existing posts by their raw GUID or link, while the
+// scraper keys items by their canonical permalink or link, see postItemKey.
+// The keys are computed in Go, which SQL migrations can't do, so this one is
+// registered with goose next to the SQL migrations in sql/schema.
+func init() {
+	goose.AddNamedMigrationContext("019_posts_item_key_backfill.go", upPostsItemKeyBackfill, downPostsItemKeyBackfill)
+}
+
+func upPostsItemKeyBackfill(ctx context.Context, tx *sql.Tx) error {
+	return rekeyLegacyPosts(ctx, tx)
+}
+
+// the keys of migration 011 were only ever wrong, there's nothing to restore
+func downPostsItemKeyBackfill(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
+
+// rekeyLegacyPosts recomputes the item keys of the posts saved before
+// migration 011, which are the posts without a content hash. A post the
+// scraper saved again under its proper key since then is a duplicate of the
+// legacy post, which is kept along with the state users gave it.
+func rekeyLegacyPosts(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT id, feed_id, guid, guid_is_permalink, url, item_key FROM posts WHERE content_hash = ''`)
+	if err != nil {
+		return fmt.Errorf("couldn't get legacy posts: %w", err)
+	}
+	type legacyPost struct {
+		ID, FeedID, ItemKey string
+	}
+	var rekeyed []legacyPost
+	for rows.Next() {
+		var id, feedID, guid, url, itemKey string
+		var guidIsPermalink bool
+		if err := rows.Scan(&id, &feedID, &guid, &guidIsPermalink, &url, &itemKey); err != nil {
+			rows.Close()
+			return err
+		}
+		if newKey, ok := legacyPostItemKey(guid, guidIsPermalink, url); ok && newKey != itemKey {
+			rekeyed = append(rekeyed, legacyPost{ID: id, FeedID: feedID, ItemKey: newKey})
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, post := range rekeyed {
+		_, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE feed_id = $1 AND item_key = $2 AND id <> $3`, post.FeedID, post.ItemKey, post.ID)
+		if err != nil {
+			return fmt.Errorf("couldn't delete duplicates of post %s: %w", post.ID, err)
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE posts SET item_key = $2 WHERE id = $1`, post.ID, post.ItemKey)
+		if err != nil {
+			return fmt.Errorf("couldn't update the item key of post %s: %w", post.ID, err)
+		}
+	}
+	return nil
+}
+
+// legacyPostItemKey returns the item key of a post saved before migration
+// 011, the way postItemKey computes it from the item. Posts without a GUID
+// and a usable link would be keyed by a hash of their content, which can't be
+// told from the stored post, so false is returned for them.
+func legacyPostItemKey(guid string, guidIsPermalink bool, url string) (string, bool) {
+	item := RSSItem{
+		Link: url,
+		GUID: RSSGUID{Value: guid, IsPermaLink: strconv.FormatBool(guidIsPermalink)},
+	}
+	if guid == "" {
+		if _, err := canonicalizeLink(url); err != nil {
+			return "", false
+		}
+	}
+	return postItemKey(item), true
+}
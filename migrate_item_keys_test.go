@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+func TestLegacyPostItemKey(t *testing.T) {
+	tests := []struct {
+		name            string
+		guid            string
+		guidIsPermalink bool
+		url             string
+		want            string
+		wantOK          bool
+	}{
+		{"saved before GUIDs were stored", "", false, "http://Example.com/1?utm_source=rss#top", "link:https://example.com/1", true},
+		{"guid", "post-1", false, "https://example.com/1", "guid:post-1", true},
+		{"permalink guid", "http://example.com/1?fbclid=x", true, "https://example.com/1", "guid:https://example.com/1", true},
+		{"no guid and no usable link", "", false, "/relative/1", "", false},
+	}
+	for _, tc := range tests {
+		got, ok := legacyPostItemKey(tc.guid, tc.guidIsPermalink, tc.url)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("%s: got: %v %v want: %v %v", tc.name, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+// TestRekeyLegacyPosts saves a post the way it was saved before migration
+// 011, and checks that scraping its item again after the migration doesn't
+// duplicate it. It needs a Postgres database, see BenchmarkIngestFeed.
+func TestRekeyLegacyPosts(t *testing.T) {
+	conn := openTestDB(t)
+	defer conn.Close()
+
+	ctx := context.Background()
+	db := database.New(conn)
+	feed, err := db.CreateFeed(ctx, database.CreateFeedParams{
+		ID:        uuid.New(),
+		Name:      "Legacy feed",
+		Url:       "https://legacy.example.com/" + uuid.NewString(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create feed: %v", err)
+	}
+	defer conn.ExecContext(ctx, "DELETE FROM feeds WHERE id = $1", feed.ID)
+
+	// posts of migration 011 are keyed by their raw link and have no content hash
+	link := "http://Legacy.example.com/post?utm_source=rss"
+	legacyId := uuid.New()
+	_, err = conn.ExecContext(ctx, `INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id, item_key)
+		VALUES ($1, NOW(), NOW(), 'Legacy post', $2, NOW(), $3, $4)`, legacyId, link, feed.ID, "link:"+link)
+	if err != nil {
+		t.Fatalf("Failed to save legacy post: %v", err)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	err = rekeyLegacyPosts(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to rekey legacy posts: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	_, err = upsertFeedItems(ctx, db, feed, []RSSItem{{Title: "Legacy post", Link: link}})
+	if err != nil {
+		t.Fatalf("Failed to save items: %v", err)
+	}
+	var count int
+	var id uuid.UUID
+	err = conn.QueryRowContext(ctx, "SELECT COUNT(*), MIN(id::text)::uuid FROM posts WHERE feed_id = $1", feed.ID).Scan(&count, &id)
+	if err != nil {
+		t.Fatalf("Failed to count posts: %v", err)
+	}
+	if count != 1 || id != legacyId {
+		t.Errorf("Legacy post was duplicated, got %d posts, first: %v want: 1 post %v", count, id, legacyId)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,13 +17,146 @@ type User struct {
 }
 
 type Feed struct {
-	ID            uuid.UUID `json:"id"`
-	Name          string    `json:"name"`
-	Url           string    `json:"url"`
-	CreatedAt     time.Time `json:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt"`
-	UserID        uuid.UUID `json:"userId"`
-	LastFetchedAt time.Time `json:"lastFetchedAt"`
+	ID                  uuid.UUID `json:"id"`
+	Name                string    `json:"name"`
+	Url                 string    `json:"url"`
+	CreatedAt           time.Time `json:"createdAt"`
+	UpdatedAt           time.Time `json:"updatedAt"`
+	UserID              uuid.UUID `json:"userId"`
+	LastFetchedAt       time.Time `json:"lastFetchedAt"`
+	LastSuccessAt       time.Time `json:"lastSuccessAt"`
+	LastError           string    `json:"lastError"`
+	ConsecutiveFailures int32     `json:"consecutiveFailures"`
+	NextFetchAt         time.Time `json:"nextFetchAt"`
+	Disabled            bool      `json:"disabled"`
+	// set if the feed answered with 410 Gone, it is disabled then too
+	Gone bool `json:"gone"`
+	// number of posts of the feed the user hasn't read
+	UnreadCount int64 `json:"unreadCount"`
+	// folder the user put the feed in, null if it's in none
+	Folder *FeedFolder `json:"folder"`
+}
+
+type FeedFolder struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+type Folder struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// number of posts of the feeds in the folder the user hasn't read
+	UnreadCount int64 `json:"unreadCount"`
+}
+
+// FeedCandidate is a feed found at a URL given by a user
+type FeedCandidate struct {
+	Url   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// OutputFeed renders the posts of a user as a feed, filtered by the optional
+// feed, folder, tag and keyword. The feed is served at URLs with the token of
+// the output feed, one per format.
+type OutputFeed struct {
+	ID        uuid.UUID      `json:"id"`
+	Title     string         `json:"title"`
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"updatedAt"`
+	FeedID    *uuid.UUID     `json:"feedId"`
+	FolderID  *uuid.UUID     `json:"folderId"`
+	Tag       string         `json:"tag,omitempty"`
+	Keyword   string         `json:"keyword,omitempty"`
+	Urls      OutputFeedUrls `json:"urls"`
+}
+
+type OutputFeedUrls struct {
+	RSS      string `json:"rss"`
+	Atom     string `json:"atom"`
+	JSONFeed string `json:"jsonFeed"`
+}
+
+// Webhook is an endpoint new posts of the feeds a user follows are sent to,
+// optionally only posts of some feeds or matching some keywords
+type Webhook struct {
+	ID        uuid.UUID   `json:"id"`
+	Url       string      `json:"url"`
+	CreatedAt time.Time   `json:"createdAt"`
+	UpdatedAt time.Time   `json:"updatedAt"`
+	FeedIds   []uuid.UUID `json:"feedIds"`
+	Keywords  []string    `json:"keywords"`
+	// key of the signatures of the deliveries, only returned on creation
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookDelivery is a post sent to a webhook, along with the attempts
+// to send it
+type WebhookDelivery struct {
+	ID            uuid.UUID       `json:"id"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	PostID        *uuid.UUID      `json:"postId"`
+	Status        string          `json:"status"`
+	Attempts      int32           `json:"attempts"`
+	NextAttemptAt time.Time       `json:"nextAttemptAt"`
+	LastAttemptAt time.Time       `json:"lastAttemptAt"`
+	DeliveredAt   time.Time       `json:"deliveredAt"`
+	Payload       json.RawMessage `json:"payload"`
+	// attempts to send the delivery, oldest first
+	AttemptLog []WebhookDeliveryAttempt `json:"attemptLog"`
+}
+
+type WebhookDeliveryAttempt struct {
+	CreatedAt time.Time `json:"createdAt"`
+	// 0 if the webhook didn't respond
+	StatusCode int32  `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int32  `json:"durationMs"`
+}
+
+type Post struct {
+	ID                uuid.UUID   `json:"id"`
+	CreatedAt         time.Time   `json:"createdAt"`
+	UpdatedAt         time.Time   `json:"updatedAt"`
+	Title             string      `json:"title"`
+	Url               string      `json:"url"`
+	PublishedAt       time.Time   `json:"publishedAt"`
+	PublishedAtSource string      `json:"publishedAtSource"`
+	FeedID            uuid.UUID   `json:"feedId"`
+	Description       string      `json:"description"`
+	Content           string      `json:"content"`
+	Author            string      `json:"author"`
+	Categories        []string    `json:"categories"`
+	Guid              string      `json:"guid"`
+	GuidIsPermalink   bool        `json:"guidIsPermalink"`
+	CommentsUrl       string      `json:"commentsUrl"`
+	Enclosures        []Enclosure `json:"enclosures"`
+	EditedAt          time.Time   `json:"editedAt"`
+	// state of the post for the user
+	Read     bool      `json:"read"`
+	ReadAt   time.Time `json:"readAt"`
+	Starred  bool      `json:"starred"`
+	Archived bool      `json:"archived"`
+}
+
+type PostState struct {
+	PostID   uuid.UUID `json:"postId"`
+	Read     bool      `json:"read"`
+	ReadAt   time.Time `json:"readAt"`
+	Starred  bool      `json:"starred"`
+	Archived bool      `json:"archived"`
+}
+
+type Enclosure struct {
+	Url    string `json:"url"`
+	Type   string `json:"type"`
+	Length int64  `json:"length,omitempty"`
+}
+
+type PostsPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
 func databaseUserToUser(dbUser database.User) User {
@@ -35,15 +169,116 @@ func databaseUserToUser(dbUser database.User) User {
 	}
 }
 
-func databaseFeedToFeed(dbFeed database.Feed) Feed {
+// databaseFeedFollowToFeed returns a feed as seen by one of its followers
+func databaseFeedFollowToFeed(dbFeedFollow database.FeedFollow, dbFeed database.Feed) Feed {
 	return Feed{
-		ID:            dbFeed.ID,
-		Name:          dbFeed.Name,
-		Url:           dbFeed.Url,
-		CreatedAt:     dbFeed.CreatedAt,
-		UpdatedAt:     dbFeed.UpdatedAt,
-		UserID:        dbFeed.UserID,
-		LastFetchedAt: dbFeed.LastFetchedAt.Time,
+		ID:                  dbFeed.ID,
+		Name:                dbFeedFollow.Name,
+		Url:                 dbFeed.Url,
+		CreatedAt:           dbFeedFollow.CreatedAt,
+		UpdatedAt:           dbFeedFollow.UpdatedAt,
+		UserID:              dbFeedFollow.UserID,
+		LastFetchedAt:       dbFeed.LastFetchedAt.Time,
+		LastSuccessAt:       dbFeed.LastSuccessAt.Time,
+		LastError:           dbFeed.LastError.String,
+		ConsecutiveFailures: dbFeed.ConsecutiveFailures,
+		NextFetchAt:         dbFeed.NextFetchAt.Time,
+		Disabled:            dbFeed.DisabledAt.Valid,
+		Gone:                dbFeed.GoneAt.Valid,
+	}
+}
+
+func databaseFolderToFolder(dbFolder database.Folder) Folder {
+	return Folder{
+		ID:        dbFolder.ID,
+		Name:      dbFolder.Name,
+		CreatedAt: dbFolder.CreatedAt,
+		UpdatedAt: dbFolder.UpdatedAt,
+	}
+}
+
+// databaseOutputFeedToOutputFeed converts an output feed, baseURL is the
+// URL its feed URLs are relative to
+func databaseOutputFeedToOutputFeed(dbOutputFeed database.OutputFeed, baseURL string) OutputFeed {
+	outputFeed := OutputFeed{
+		ID:        dbOutputFeed.ID,
+		Title:     dbOutputFeed.Title,
+		CreatedAt: dbOutputFeed.CreatedAt,
+		UpdatedAt: dbOutputFeed.UpdatedAt,
+		Tag:       dbOutputFeed.Tag.String,
+		Keyword:   dbOutputFeed.Keyword.String,
+		Urls: OutputFeedUrls{
+			RSS:      outputFeedURL(baseURL, dbOutputFeed.Token, outputFormatRSS),
+			Atom:     outputFeedURL(baseURL, dbOutputFeed.Token, outputFormatAtom),
+			JSONFeed: outputFeedURL(baseURL, dbOutputFeed.Token, outputFormatJSON),
+		},
+	}
+	if dbOutputFeed.FeedID.Valid {
+		outputFeed.FeedID = &dbOutputFeed.FeedID.UUID
+	}
+	if dbOutputFeed.FolderID.Valid {
+		outputFeed.FolderID = &dbOutputFeed.FolderID.UUID
+	}
+	return outputFeed
+}
+
+func databaseWebhookToWebhook(dbWebhook database.Webhook) Webhook {
+	return Webhook{
+		ID:        dbWebhook.ID,
+		Url:       dbWebhook.Url,
+		CreatedAt: dbWebhook.CreatedAt,
+		UpdatedAt: dbWebhook.UpdatedAt,
+		FeedIds:   dbWebhook.FeedIds,
+		Keywords:  dbWebhook.Keywords,
+	}
+}
+
+func databaseWebhookAttemptToWebhookAttempt(dbAttempt database.WebhookDeliveryAttempt) WebhookDeliveryAttempt {
+	return WebhookDeliveryAttempt{
+		CreatedAt:  dbAttempt.CreatedAt,
+		StatusCode: dbAttempt.StatusCode.Int32,
+		Error:      dbAttempt.Error.String,
+		DurationMs: dbAttempt.DurationMs,
+	}
+}
+
+func databasePostToPost(dbPost database.Post) Post {
+	return Post{
+		ID:                dbPost.ID,
+		CreatedAt:         dbPost.CreatedAt,
+		UpdatedAt:         dbPost.UpdatedAt,
+		Title:             dbPost.Title,
+		Url:               dbPost.Url,
+		PublishedAt:       dbPost.PublishedAt,
+		PublishedAtSource: dbPost.PublishedAtSource,
+		FeedID:            dbPost.FeedID,
+		Description:       dbPost.Description,
+		Content:           dbPost.Content,
+		Author:            dbPost.Author,
+		Categories:        dbPost.Categories,
+		Guid:              dbPost.Guid,
+		GuidIsPermalink:   dbPost.GuidIsPermalink,
+		CommentsUrl:       dbPost.CommentsUrl,
+		Enclosures:        []Enclosure{},
+		EditedAt:          dbPost.EditedAt.Time,
+	}
+}
+
+func databasePostStateToPostState(dbState database.UserPostState) PostState {
+	return PostState{
+		PostID:   dbState.PostID,
+		Read:     dbState.Read,
+		ReadAt:   dbState.ReadAt.Time,
+		Starred:  dbState.Starred,
+		Archived: dbState.Archived,
+	}
+}
+
+func databaseEnclosureToEnclosure(dbEnclosure database.PostEnclosure) Enclosure {
+	return Enclosure{
+		Url:    dbEnclosure.Url,
+		Type:   dbEnclosure.Type,
+		Length: dbEnclosure.Length.Int64,
 	}
 }
 
@@ -55,10 +290,100 @@ func databaseUsersToUsers(dbUsers []database.User) []User {
 	return users
 }
 
-func databaseFeedsToFeeds(dbFeeds []database.Feed) []Feed {
+func databaseFeedFollowsToFeeds(dbFeedFollows []database.GetFeedFollowsOfUserRow) []Feed {
 	feeds := []Feed{}
-	for _, dbFeed := range dbFeeds {
-		feeds = append(feeds, databaseFeedToFeed(dbFeed))
+	for _, dbFeedFollow := range dbFeedFollows {
+		feed := databaseFeedFollowToFeed(dbFeedFollow.FeedFollow, dbFeedFollow.Feed)
+		if dbFeedFollow.FeedFollow.FolderID.Valid {
+			feed.Folder = &FeedFolder{
+				ID:   dbFeedFollow.FeedFollow.FolderID.UUID,
+				Name: dbFeedFollow.FolderName.String,
+			}
+		}
+		feeds = append(feeds, feed)
 	}
 	return feeds
 }
+
+func databaseOutputFeedsToOutputFeeds(dbOutputFeeds []database.OutputFeed, baseURL string) []OutputFeed {
+	outputFeeds := []OutputFeed{}
+	for _, dbOutputFeed := range dbOutputFeeds {
+		outputFeeds = append(outputFeeds, databaseOutputFeedToOutputFeed(dbOutputFeed, baseURL))
+	}
+	return outputFeeds
+}
+
+func databaseFoldersToFolders(dbFolders []database.Folder) []Folder {
+	folders := []Folder{}
+	for _, dbFolder := range dbFolders {
+		folders = append(folders, databaseFolderToFolder(dbFolder))
+	}
+	return folders
+}
+
+// databasePostsToPosts converts posts along with their enclosures and their
+// state for the user, posts without a state are unread
+func databasePostsToPosts(dbPosts []database.Post, dbEnclosures []database.PostEnclosure, dbStates []database.UserPostState) []Post {
+	enclosures := map[uuid.UUID][]Enclosure{}
+	for _, dbEnclosure := range dbEnclosures {
+		enclosures[dbEnclosure.PostID] = append(enclosures[dbEnclosure.PostID], databaseEnclosureToEnclosure(dbEnclosure))
+	}
+	states := map[uuid.UUID]database.UserPostState{}
+	for _, dbState := range dbStates {
+		states[dbState.PostID] = dbState
+	}
+	posts := []Post{}
+	for _, dbPost := range dbPosts {
+		post := databasePostToPost(dbPost)
+		if postEnclosures, ok := enclosures[dbPost.ID]; ok {
+			post.Enclosures = postEnclosures
+		}
+		if state, ok := states[dbPost.ID]; ok {
+			post.Read = state.Read
+			post.ReadAt = state.ReadAt.Time
+			post.Starred = state.Starred
+			post.Archived = state.Archived
+		}
+		posts = append(posts, post)
+	}
+	return posts
+}
+
+func databaseWebhooksToWebhooks(dbWebhooks []database.Webhook) []Webhook {
+	webhooks := []Webhook{}
+	for _, dbWebhook := range dbWebhooks {
+		webhooks = append(webhooks, databaseWebhookToWebhook(dbWebhook))
+	}
+	return webhooks
+}
+
+// databaseDeliveriesToDeliveries converts deliveries to webhooks along with
+// their attempts
+func databaseDeliveriesToDeliveries(dbDeliveries []database.WebhookDelivery, dbAttempts []database.WebhookDeliveryAttempt) []WebhookDelivery {
+	attempts := map[uuid.UUID][]WebhookDeliveryAttempt{}
+	for _, dbAttempt := range dbAttempts {
+		attempts[dbAttempt.DeliveryID] = append(attempts[dbAttempt.DeliveryID], databaseWebhookAttemptToWebhookAttempt(dbAttempt))
+	}
+	deliveries := []WebhookDelivery{}
+	for _, dbDelivery := range dbDeliveries {
+		delivery := WebhookDelivery{
+			ID:            dbDelivery.ID,
+			CreatedAt:     dbDelivery.CreatedAt,
+			Status:        dbDelivery.Status,
+			Attempts:      dbDelivery.Attempts,
+			NextAttemptAt: dbDelivery.NextAttemptAt,
+			LastAttemptAt: dbDelivery.LastAttemptAt.Time,
+			DeliveredAt:   dbDelivery.DeliveredAt.Time,
+			Payload:       json.RawMessage(dbDelivery.Payload),
+			AttemptLog:    []WebhookDeliveryAttempt{},
+		}
+		if dbDelivery.PostID.Valid {
+			delivery.PostID = &dbDelivery.PostID.UUID
+		}
+		if deliveryAttempts, ok := attempts[dbDelivery.ID]; ok {
+			delivery.AttemptLog = deliveryAttempts
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
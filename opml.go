@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// opmlDocument is an OPML 1.0 or 2.0 document, the format feed readers
+// import and export their subscriptions in
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlOutline is a subscription if it has an xmlUrl, and otherwise a folder
+// of the outlines nested in it
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlSubscription is a feed listed in an OPML document
+type opmlSubscription struct {
+	Title string
+	URL   string
+	// name of the folder the feed is in, "" if it's in none
+	Folder string
+}
+
+func parseOPML(contentType string, dat []byte) (opmlDocument, error) {
+	dat, err := feedToUTF8(contentType, dat)
+	if err != nil {
+		return opmlDocument{}, err
+	}
+	doc := opmlDocument{}
+	err = xml.Unmarshal(dat, &doc)
+	if err != nil {
+		return opmlDocument{}, err
+	}
+	return doc, nil
+}
+
+// subscriptions returns the feeds listed in a document in their order. Feeds
+// in nested folders are put into the innermost folder, as folders can't be
+// nested.
+func (doc opmlDocument) subscriptions() []opmlSubscription {
+	subscriptions := []opmlSubscription{}
+	var visit func(outlines []opmlOutline, folder string)
+	visit = func(outlines []opmlOutline, folder string) {
+		for _, outline := range outlines {
+			if strings.TrimSpace(outline.XMLURL) != "" {
+				subscriptions = append(subscriptions, opmlSubscription{
+					Title:  outline.title(),
+					URL:    strings.TrimSpace(outline.XMLURL),
+					Folder: folder,
+				})
+				continue
+			}
+			subfolder := outline.title()
+			if subfolder == "" {
+				subfolder = folder
+			}
+			visit(outline.Outlines, subfolder)
+		}
+	}
+	visit(doc.Body.Outlines, "")
+	return subscriptions
+}
+
+// title returns the title of an outline, text is required by OPML but
+// exporters fill in title instead at times
+func (outline opmlOutline) title() string {
+	if text := strings.TrimSpace(outline.Text); text != "" {
+		return text
+	}
+	return strings.TrimSpace(outline.Title)
+}
+
+// newOPMLDocument returns an OPML 2.0 document of the feeds a user follows,
+// the feeds in folders are nested in an outline per folder
+func newOPMLDocument(title string, feeds []Feed, folders []Folder, now time.Time) opmlDocument {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       title,
+			DateCreated: now.UTC().Format(time.RFC1123Z),
+		},
+	}
+	folderOutlines := map[string][]opmlOutline{}
+	for _, feed := range feeds {
+		outline := opmlOutline{Text: feed.Name, Title: feed.Name, Type: "rss", XMLURL: feed.Url}
+		if feed.Folder == nil {
+			doc.Body.Outlines = append(doc.Body.Outlines, outline)
+			continue
+		}
+		folderOutlines[feed.Folder.Name] = append(folderOutlines[feed.Folder.Name], outline)
+	}
+	for _, folder := range folders {
+		doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{
+			Text:     folder.Name,
+			Title:    folder.Name,
+			Outlines: folderOutlines[folder.Name],
+		})
+	}
+	return doc
+}
+
+func (doc opmlDocument) marshal() ([]byte, error) {
+	dat, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal OPML document: %w", err)
+	}
+	return append([]byte(xml.Header), dat...), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseOPML(t *testing.T) {
+	doc, err := parseOPML("text/x-opml", readFixture(t, "subscriptions.opml"))
+	if err != nil {
+		t.Fatalf("Failed to parse OPML document: %v", err)
+	}
+	want := []opmlSubscription{
+		{Title: "Go Blog", URL: "https://go.dev/blog/feed.atom"},
+		{Title: "Café News", URL: "https://news.example.com/rss", Folder: "News"},
+		// folders can't be nested, the innermost folder is used
+		{Title: "City", URL: "https://city.example.com/feed", Folder: "Local"},
+	}
+	if got := doc.subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong subscriptions, got: %+v want: %+v", got, want)
+	}
+
+	_, err = parseOPML("application/rss+xml", readFixture(t, "rss2.xml"))
+	if err == nil {
+		t.Errorf("Expected an error parsing a feed as OPML")
+	}
+}
+
+func TestOPMLExportRoundTrip(t *testing.T) {
+	folder := Folder{ID: uuid.New(), Name: "News & Politics"}
+	feeds := []Feed{
+		{Name: "Go Blog", Url: "https://go.dev/blog/feed.atom"},
+		{Name: "Daily", Url: "https://news.example.com/rss?a=1&b=2", Folder: &FeedFolder{ID: folder.ID, Name: folder.Name}},
+	}
+	doc := newOPMLDocument("Feeds", feeds, []Folder{folder}, time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	dat, err := doc.marshal()
+	if err != nil {
+		t.Fatalf("Failed to marshal OPML document: %v", err)
+	}
+
+	parsed, err := parseOPML("text/x-opml; charset=utf-8", dat)
+	if err != nil {
+		t.Fatalf("Failed to parse exported OPML document: %v\n%s", err, dat)
+	}
+	if parsed.Version != "2.0" || parsed.Head.DateCreated != "Fri, 01 Mar 2024 12:00:00 +0000" {
+		t.Errorf("Wrong version or creation date, got: %v %v", parsed.Version, parsed.Head.DateCreated)
+	}
+	want := []opmlSubscription{
+		{Title: "Go Blog", URL: "https://go.dev/blog/feed.atom"},
+		{Title: "Daily", URL: "https://news.example.com/rss?a=1&b=2", Folder: "News & Politics"},
+	}
+	if got := parsed.subscriptions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Wrong subscriptions, got: %+v want: %+v", got, want)
+	}
+}
+
+func TestCheckSubscriptionURLs(t *testing.T) {
+	// a DNS server that never answers
+	guard := newURLGuard(nil)
+	guard.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	apiCfg := apiConfig{Fetcher: &feedFetcher{guard: guard}}
+	subscriptions := []opmlSubscription{
+		{URL: "https://93.184.216.34/feed.xml"},
+		{URL: "http://127.0.0.1/feed.xml"},
+		{URL: "https://slow.example.com/feed.xml"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	invalid := apiCfg.checkSubscriptionURLs(ctx, subscriptions)
+	if invalid[0] != "" {
+		t.Errorf("Wrong result for a public address, got: %q want no error", invalid[0])
+	}
+	if !strings.Contains(invalid[1], "not allowed") {
+		t.Errorf("Wrong result for a loopback address, got: %q", invalid[1])
+	}
+	if !strings.Contains(invalid[2], "in time") {
+		t.Errorf("Wrong result for a host that couldn't be resolved in time, got: %q", invalid[2])
+	}
+}
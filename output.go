@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// formats output feeds are rendered in, by the last segment of their URLs
+const (
+	outputFormatRSS  = "rss"
+	outputFormatAtom = "atom"
+	outputFormatJSON = "json"
+)
+
+var outputContentTypes = map[string]string{
+	outputFormatRSS:  "application/rss+xml; charset=utf-8",
+	outputFormatAtom: "application/atom+xml; charset=utf-8",
+	outputFormatJSON: "application/feed+json; charset=utf-8",
+}
+
+// number of posts in an output feed
+const outputFeedLimit = 50
+
+// outputDocument is the content of an output feed, rendered in one of the
+// output formats
+type outputDocument struct {
+	ID      string
+	Title   string
+	SelfURL string
+	Updated time.Time
+	Posts   []Post
+}
+
+// newOutputDocument returns the document of an output feed, which was last
+// updated when its latest post was published or edited
+func newOutputDocument(outputFeed database.OutputFeed, selfURL string, posts []Post) outputDocument {
+	doc := outputDocument{
+		ID:      "urn:uuid:" + outputFeed.ID.String(),
+		Title:   outputFeed.Title,
+		SelfURL: selfURL,
+		Updated: outputFeed.CreatedAt,
+		Posts:   posts,
+	}
+	for _, post := range posts {
+		if updated := postUpdatedAt(post); updated.After(doc.Updated) {
+			doc.Updated = updated
+		}
+	}
+	return doc
+}
+
+func (doc outputDocument) render(format string) ([]byte, error) {
+	switch format {
+	case outputFormatRSS:
+		return doc.renderRSS()
+	case outputFormatAtom:
+		return doc.renderAtom()
+	case outputFormatJSON:
+		return doc.renderJSONFeed()
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+type rssOutput struct {
+	XMLName   xml.Name         `xml:"rss"`
+	Version   string           `xml:"version,attr"`
+	AtomNS    string           `xml:"xmlns:atom,attr"`
+	ContentNS string           `xml:"xmlns:content,attr"`
+	DCNS      string           `xml:"xmlns:dc,attr"`
+	Channel   rssOutputChannel `xml:"channel"`
+}
+
+type rssOutputChannel struct {
+	Title         string          `xml:"title"`
+	Link          string          `xml:"link"`
+	Description   string          `xml:"description"`
+	SelfLink      rssOutputLink   `xml:"atom:link"`
+	LastBuildDate string          `xml:"lastBuildDate"`
+	Items         []rssOutputItem `xml:"item"`
+}
+
+type rssOutputLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssOutputGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink string `xml:"isPermaLink,attr,omitempty"`
+}
+
+type rssOutputItem struct {
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link,omitempty"`
+	GUID        rssOutputGUID  `xml:"guid"`
+	PubDate     string         `xml:"pubDate"`
+	Description string         `xml:"description,omitempty"`
+	Content     string         `xml:"content:encoded,omitempty"`
+	Creator     string         `xml:"dc:creator,omitempty"`
+	Categories  []string       `xml:"category"`
+	Comments    string         `xml:"comments,omitempty"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
+}
+
+func (doc outputDocument) renderRSS() ([]byte, error) {
+	output := rssOutput{
+		Version:   "2.0",
+		AtomNS:    atomNamespace,
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssOutputChannel{
+			Title:         doc.Title,
+			Link:          doc.SelfURL,
+			Description:   doc.Title,
+			SelfLink:      rssOutputLink{Href: doc.SelfURL, Rel: "self", Type: "application/rss+xml"},
+			LastBuildDate: doc.Updated.UTC().Format(time.RFC1123Z),
+			Items:         []rssOutputItem{},
+		},
+	}
+	for _, post := range doc.Posts {
+		item := rssOutputItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			GUID:        rssOutputGUID{Value: outputPostID(post), IsPermaLink: "false"},
+			PubDate:     post.PublishedAt.UTC().Format(time.RFC1123Z),
+			Description: post.Description,
+			Content:     post.Content,
+			Creator:     post.Author,
+			Categories:  post.Categories,
+			Comments:    post.CommentsUrl,
+		}
+		if post.GuidIsPermalink {
+			item.GUID = rssOutputGUID{Value: post.Guid}
+		}
+		for _, enclosure := range post.Enclosures {
+			item.Enclosures = append(item.Enclosures, RSSEnclosure{
+				URL:    enclosure.Url,
+				Type:   enclosure.Type,
+				Length: strconv.FormatInt(enclosure.Length, 10),
+			})
+		}
+		output.Channel.Items = append(output.Channel.Items, item)
+	}
+	return marshalXMLDocument(output)
+}
+
+type atomOutput struct {
+	XMLName xml.Name         `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string           `xml:"id"`
+	Title   string           `xml:"title"`
+	Updated string           `xml:"updated"`
+	Links   []atomOutputLink `xml:"link"`
+	// Atom requires an author of the feed, unless all entries have one
+	Author  atomOutputPerson  `xml:"author"`
+	Entries []atomOutputEntry `xml:"entry"`
+}
+
+type atomOutputEntry struct {
+	ID         string               `xml:"id"`
+	Title      string               `xml:"title"`
+	Links      []atomOutputLink     `xml:"link"`
+	Published  string               `xml:"published"`
+	Updated    string               `xml:"updated"`
+	Author     *atomOutputPerson    `xml:"author,omitempty"`
+	Summary    *atomOutputText      `xml:"summary,omitempty"`
+	Content    *atomOutputText      `xml:"content,omitempty"`
+	Categories []atomOutputCategory `xml:"category"`
+}
+
+type atomOutputLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length string `xml:"length,attr,omitempty"`
+}
+
+type atomOutputPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomOutputCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomOutputText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+func (doc outputDocument) renderAtom() ([]byte, error) {
+	output := atomOutput{
+		ID:      doc.ID,
+		Title:   doc.Title,
+		Updated: doc.Updated.UTC().Format(time.RFC3339),
+		Links:   []atomOutputLink{{Href: doc.SelfURL, Rel: "self", Type: "application/atom+xml"}},
+		Author:  atomOutputPerson{Name: "scraperss"},
+	}
+	for _, post := range doc.Posts {
+		entry := atomOutputEntry{
+			ID:        outputPostID(post),
+			Title:     post.Title,
+			Published: post.PublishedAt.UTC().Format(time.RFC3339),
+			Updated:   postUpdatedAt(post).UTC().Format(time.RFC3339),
+		}
+		if post.Url != "" {
+			entry.Links = append(entry.Links, atomOutputLink{Href: post.Url, Rel: "alternate", Type: "text/html"})
+		}
+		for _, enclosure := range post.Enclosures {
+			link := atomOutputLink{Href: enclosure.Url, Rel: "enclosure", Type: enclosure.Type}
+			if enclosure.Length > 0 {
+				link.Length = strconv.FormatInt(enclosure.Length, 10)
+			}
+			entry.Links = append(entry.Links, link)
+		}
+		if post.Author != "" {
+			entry.Author = &atomOutputPerson{Name: post.Author}
+		}
+		if post.Description != "" {
+			entry.Summary = &atomOutputText{Type: "html", Text: post.Description}
+		}
+		if post.Content != "" {
+			entry.Content = &atomOutputText{Type: "html", Text: post.Content}
+		}
+		for _, category := range post.Categories {
+			entry.Categories = append(entry.Categories, atomOutputCategory{Term: category})
+		}
+		output.Entries = append(output.Entries, entry)
+	}
+	return marshalXMLDocument(output)
+}
+
+type jsonFeedOutput struct {
+	Version string               `json:"version"`
+	Title   string               `json:"title"`
+	FeedURL string               `json:"feed_url"`
+	Items   []jsonFeedOutputItem `json:"items"`
+}
+
+type jsonFeedOutputItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified,omitempty"`
+	Authors       []JSONFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []JSONFeedAttachment `json:"attachments,omitempty"`
+}
+
+func (doc outputDocument) renderJSONFeed() ([]byte, error) {
+	output := jsonFeedOutput{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   doc.Title,
+		FeedURL: doc.SelfURL,
+		Items:   []jsonFeedOutputItem{},
+	}
+	for _, post := range doc.Posts {
+		item := jsonFeedOutputItem{
+			ID:            outputPostID(post),
+			URL:           post.Url,
+			Title:         post.Title,
+			ContentHTML:   post.Content,
+			Summary:       post.Description,
+			DatePublished: post.PublishedAt.UTC().Format(time.RFC3339),
+			Tags:          post.Categories,
+		}
+		// items need content, the summary stands in for posts without one
+		if item.ContentHTML == "" {
+			item.ContentHTML = post.Description
+		}
+		if !post.EditedAt.IsZero() {
+			item.DateModified = post.EditedAt.UTC().Format(time.RFC3339)
+		}
+		if post.Author != "" {
+			item.Authors = []JSONFeedAuthor{{Name: post.Author}}
+		}
+		for _, enclosure := range post.Enclosures {
+			item.Attachments = append(item.Attachments, JSONFeedAttachment{
+				URL:         enclosure.Url,
+				MimeType:    enclosure.Type,
+				SizeInBytes: enclosure.Length,
+			})
+		}
+		output.Items = append(output.Items, item)
+	}
+	dat, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal JSON feed: %w", err)
+	}
+	return dat, nil
+}
+
+func marshalXMLDocument(doc any) ([]byte, error) {
+	dat, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal feed: %w", err)
+	}
+	return append([]byte(xml.Header), dat...), nil
+}
+
+// outputPostID returns the ID of a post in output feeds, which stays the same
+// when the post is edited
+func outputPostID(post Post) string {
+	return "urn:uuid:" + post.ID.String()
+}
+
+// postUpdatedAt returns when a post was last edited, or else published
+func postUpdatedAt(post Post) time.Time {
+	if post.EditedAt.After(post.PublishedAt) {
+		return post.EditedAt
+	}
+	return post.PublishedAt
+}
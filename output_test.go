@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// output feeds are parsed back with the feed parsers of the scraper, so that
+// readers of every format see the same posts
+func TestOutputFeedFormats(t *testing.T) {
+	published := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	outputFeed := database.OutputFeed{ID: uuid.New(), Title: "Posts & more", CreatedAt: published.Add(-time.Hour)}
+	posts := []Post{
+		{
+			ID:              uuid.New(),
+			Title:           "Edited <post>",
+			Url:             "https://example.com/2?a=1&b=2",
+			PublishedAt:     published,
+			EditedAt:        published.Add(time.Hour),
+			Description:     "A short summary",
+			Content:         "<p>The <em>full</em> post</p>",
+			Author:          "Jane Doe",
+			Categories:      []string{"go", "rss"},
+			Guid:            "https://example.com/2",
+			GuidIsPermalink: true,
+			Enclosures:      []Enclosure{{Url: "https://example.com/2.mp3", Type: "audio/mpeg", Length: 12345}},
+		},
+		{
+			ID:          uuid.New(),
+			Title:       "Plain post",
+			Url:         "https://example.com/1",
+			PublishedAt: published.Add(-24 * time.Hour),
+			Description: "Only a summary",
+			Categories:  []string{},
+		},
+	}
+	doc := newOutputDocument(outputFeed, "https://scraperss.example.com/v1/output/token/rss", posts)
+	if !doc.Updated.Equal(published.Add(time.Hour)) {
+		t.Errorf("Output feed should be updated when its latest post was edited, got: %v", doc.Updated)
+	}
+
+	for _, format := range []string{outputFormatRSS, outputFormatAtom, outputFormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			dat, err := doc.render(format)
+			if err != nil {
+				t.Fatalf("Failed to render output feed: %v", err)
+			}
+			parsed, err := parseFeed(outputContentTypes[format], dat)
+			if err != nil {
+				t.Fatalf("Failed to parse output feed: %v\n%s", err, dat)
+			}
+			if parsed.Channel.Title != "Posts & more" {
+				t.Errorf("Wrong title, got: %q", parsed.Channel.Title)
+			}
+			if len(parsed.Channel.Item) != 2 {
+				t.Fatalf("Expected 2 items, got: %d\n%s", len(parsed.Channel.Item), dat)
+			}
+			item := parsed.Channel.Item[0]
+			if item.Title != "Edited <post>" || item.Link != "https://example.com/2?a=1&b=2" {
+				t.Errorf("Wrong title or link, got: %q %q", item.Title, item.Link)
+			}
+			if got, _ := resolvePublishedAt(item, time.Now()); !got.Equal(published) {
+				t.Errorf("Wrong publication date, got: %v", got)
+			}
+			if item.Content != "<p>The <em>full</em> post</p>" || item.ItemAuthor() != "Jane Doe" {
+				t.Errorf("Wrong content or author, got: %q %q", item.Content, item.ItemAuthor())
+			}
+			if !reflect.DeepEqual(item.Categories, []string{"go", "rss"}) {
+				t.Errorf("Wrong categories, got: %v", item.Categories)
+			}
+			if len(item.Enclosures) != 1 || item.Enclosures[0].URL != "https://example.com/2.mp3" || item.Enclosures[0].Length != "12345" {
+				t.Errorf("Wrong enclosures, got: %+v", item.Enclosures)
+			}
+			if parsed.Channel.Item[1].Title != "Plain post" {
+				t.Errorf("Wrong second item, got: %q", parsed.Channel.Item[1].Title)
+			}
+		})
+	}
+
+	if _, err := doc.render("html"); err == nil {
+		t.Errorf("Expected an error rendering an unknown format")
+	}
+}
+
+// links to output feeds mustn't be taken from headers that clients control
+func TestAPIBaseURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiCfg apiConfig
+		want   string
+	}{
+		{"request", apiConfig{}, "http://service.internal/v1"},
+		{"public URL", apiConfig{PublicURL: "https://rss.example.com"}, "https://rss.example.com/v1"},
+		{"public URL over proxy headers", apiConfig{PublicURL: "https://rss.example.com", TrustProxyHeaders: true}, "https://rss.example.com/v1"},
+		{"trusted proxy headers", apiConfig{TrustProxyHeaders: true}, "https://proxy.example.com/v1"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest("GET", "http://service.internal/v1/output-feeds", nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set("X-Forwarded-Host", "proxy.example.com")
+		if got := tc.apiCfg.baseURL(r); got != tc.want {
+			t.Errorf("%s: got: %v want: %v", tc.name, got, tc.want)
+		}
+	}
+}
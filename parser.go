@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// feedParser parses documents of one feed format into an RSSFeed,
+// the internal shape consumed by the scraper
+type feedParser struct {
+	// name of the feed format, used in logs and errors
+	name string
+	// media types that are served only for this format
+	contentTypes []string
+	// sniff reports whether the document looks like this format
+	sniff func(dat []byte) bool
+	parse func(dat []byte) (RSSFeed, error)
+}
+
+// registry of supported feed formats, formats register themselves from
+// their own files
+var feedParsers []feedParser
+
+func registerFeedParser(parser feedParser) {
+	feedParsers = append(feedParsers, parser)
+}
+
+// parseFeed parses a fetched feed document using the parser selected
+// by its Content-Type and contents
+func parseFeed(contentType string, dat []byte) (RSSFeed, error) {
+	dat, err := feedToUTF8(contentType, dat)
+	if err != nil {
+		return RSSFeed{}, err
+	}
+	parser, err := selectFeedParser(contentType, dat)
+	if err != nil {
+		return RSSFeed{}, err
+	}
+	rssFeed, err := parser.parse(dat)
+	if err != nil {
+		return RSSFeed{}, fmt.Errorf("couldn't parse %s feed: %w", parser.name, err)
+	}
+	return rssFeed, nil
+}
+
+// selectFeedParser prefers the parser matching the Content-Type of the
+// document, as long as the document agrees with it. Publishers often serve
+// feeds with generic or wrong media types, so otherwise the parser is chosen
+// by sniffing the root element or JSON shape of the document.
+func selectFeedParser(contentType string, dat []byte) (feedParser, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		for _, parser := range feedParsers {
+			for _, ct := range parser.contentTypes {
+				if strings.EqualFold(mediaType, ct) && parser.sniff(dat) {
+					return parser, nil
+				}
+			}
+		}
+	}
+	for _, parser := range feedParsers {
+		if parser.sniff(dat) {
+			return parser, nil
+		}
+	}
+	return feedParser{}, fmt.Errorf("unsupported feed format (Content-Type %q)", contentType)
+}
+
+// the encoding declared in the prolog of an XML document
+var xmlEncodingDecl = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding\s*=\s*["'])([^"']+)(["'])`)
+
+// feedToUTF8 converts a feed document to UTF-8 from the charset of its
+// Content-Type or, lacking one, the encoding declared in its XML prolog. The
+// prolog of a converted document declares UTF-8, as encoding/xml only reads
+// UTF-8 documents.
+func feedToUTF8(contentType string, dat []byte) ([]byte, error) {
+	label := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		label = params["charset"]
+	}
+	dat = bytes.TrimPrefix(dat, []byte("\xef\xbb\xbf"))
+	declared := xmlEncodingDecl.FindSubmatch(dat)
+	if label == "" && declared != nil {
+		label = string(declared[2])
+	}
+	if label == "" {
+		return dat, nil
+	}
+
+	encoding, name := charset.Lookup(label)
+	if encoding == nil {
+		return nil, fmt.Errorf("unsupported charset %q", label)
+	}
+	if name != "utf-8" {
+		converted, err := encoding.NewDecoder().Bytes(dat)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't convert from charset %s: %w", name, err)
+		}
+		dat = converted
+	}
+	if declared != nil && !strings.EqualFold(string(declared[2]), "utf-8") {
+		dat = xmlEncodingDecl.ReplaceAll(dat, []byte("${1}UTF-8${3}"))
+	}
+	return dat, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	dat, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read fixture %v: %v", name, err)
+	}
+	return dat
+}
+
+func TestParseFeedFixtures(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		contentType string
+		wantParser  string
+		wantTitle   string
+		wantItems   []RSSItem
+	}{
+		{
+			fixture:     "rss2.xml",
+			contentType: "application/rss+xml; charset=utf-8",
+			wantParser:  "RSS 2.0",
+			wantTitle:   "Example RSS Blog",
+			wantItems: []RSSItem{
+				{
+					Title:       "Second post",
+					Link:        "https://rss.example.com/posts/2",
+					PubDate:     "Tue, 02 Jan 2024 10:00:00 GMT",
+					GUID:        RSSGUID{Value: "https://rss.example.com/posts/2"},
+					Description: "A short summary",
+					Content:     "<p>The <em>full</em> post</p>",
+					Creator:     "Jane Doe",
+					Categories:  []string{"go", "rss"},
+					Comments:    "https://rss.example.com/posts/2#comments",
+					Enclosures:  []RSSEnclosure{{URL: "https://rss.example.com/media/2.mp3", Type: "audio/mpeg", Length: "12345"}},
+				},
+				{
+					Title:   "First post",
+					Link:    "https://rss.example.com/posts/1",
+					PubDate: "Mon, 01 Jan 2024 10:00:00 GMT",
+					GUID:    RSSGUID{Value: "rss-example-post-1", IsPermaLink: "false"},
+					Author:  "jane@example.com (Jane Doe)",
+				},
+			},
+		},
+		{
+			fixture:     "atom.xml",
+			contentType: "application/atom+xml",
+			wantParser:  "Atom 1.0",
+			wantTitle:   "Example Atom Blog",
+			wantItems: []RSSItem{
+				{
+					Title:       "Second entry",
+					Link:        "https://atom.example.com/entries/2",
+					PubDate:     "2024-01-02T12:00:00+02:00",
+					GUID:        RSSGUID{Value: "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a", IsPermaLink: "false"},
+					Updated:     "2024-01-03T09:00:00Z",
+					Description: "Summary of the second entry",
+					Content:     `<div xmlns="http://www.w3.org/1999/xhtml"><p>Second</p></div>`,
+					Creator:     "John Doe",
+					Categories:  []string{"atom"},
+					Comments:    "https://atom.example.com/entries/2#comments",
+					Enclosures:  []RSSEnclosure{{URL: "https://atom.example.com/media/2.mp4", Type: "video/mp4", Length: "2048"}},
+				},
+				{
+					Title:   "First entry",
+					Link:    "https://atom.example.com/entries/1",
+					GUID:    RSSGUID{Value: "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6b", IsPermaLink: "false"},
+					Updated: "2024-01-01T10:00:00Z",
+					Content: "<p>First</p>",
+				},
+			},
+		},
+		{
+			fixture:     "jsonfeed.json",
+			contentType: "application/feed+json",
+			wantParser:  "JSON Feed",
+			wantTitle:   "Example JSON Feed",
+			wantItems: []RSSItem{
+				{
+					Title:       "Second item",
+					Link:        "https://json.example.com/items/2",
+					PubDate:     "2024-01-02T10:00:00Z",
+					GUID:        RSSGUID{Value: "2", IsPermaLink: "false"},
+					Description: "Greetings",
+					Content:     "<p>Hello again</p>",
+					Creator:     "Jo Doe",
+					Categories:  []string{"json"},
+					Enclosures:  []RSSEnclosure{{URL: "https://json.example.com/media/2.mp3", Type: "audio/mpeg", Length: "4096"}},
+				},
+				{
+					Title:   "First item",
+					Link:    "https://elsewhere.example.com/items/1",
+					GUID:    RSSGUID{Value: "1", IsPermaLink: "false"},
+					Updated: "2024-01-01T10:00:00Z",
+					Content: "Hello",
+					Creator: "Old Style",
+				},
+			},
+		},
+		{
+			fixture:     "rdf.xml",
+			contentType: "application/rdf+xml",
+			wantParser:  "RSS 1.0",
+			wantTitle:   "Example RDF Site",
+			wantItems: []RSSItem{
+				{
+					Title:       "Second item",
+					Link:        "https://rdf.example.com/items/2",
+					GUID:        RSSGUID{Value: "https://rdf.example.com/items/2", IsPermaLink: "false"},
+					DCDate:      "2024-01-02T10:00:00Z",
+					Description: "About the second item",
+					Content:     "<p>Second</p>",
+					Creator:     "Rita Doe",
+					Categories:  []string{"rdf"},
+				},
+				{
+					Title:  "First item",
+					Link:   "https://rdf.example.com/items/1",
+					GUID:   RSSGUID{Value: "https://rdf.example.com/items/1", IsPermaLink: "false"},
+					DCDate: "2024-01-01T10:00:00Z",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.fixture, func(t *testing.T) {
+			dat := readFixture(t, tc.fixture)
+			// the parser is selected by Content-Type, and by sniffing when
+			// the Content-Type is generic
+			for _, contentType := range []string{tc.contentType, "text/xml", ""} {
+				parser, err := selectFeedParser(contentType, dat)
+				if err != nil {
+					t.Fatalf("Failed to select a parser for Content-Type %q: %v", contentType, err)
+				}
+				if parser.name != tc.wantParser {
+					t.Errorf("Wrong parser for Content-Type %q, got: %v want: %v", contentType, parser.name, tc.wantParser)
+				}
+			}
+
+			rssFeed, err := parseFeed(tc.contentType, dat)
+			if err != nil {
+				t.Fatalf("Failed to parse fixture: %v", err)
+			}
+			if rssFeed.Channel.Title != tc.wantTitle {
+				t.Errorf("Wrong feed title, got: %v want: %v", rssFeed.Channel.Title, tc.wantTitle)
+			}
+			if len(rssFeed.Channel.Item) != len(tc.wantItems) {
+				t.Fatalf("Wrong number of items, got: %v want: %v", len(rssFeed.Channel.Item), len(tc.wantItems))
+			}
+			for i, want := range tc.wantItems {
+				if got := rssFeed.Channel.Item[i]; !reflect.DeepEqual(got, want) {
+					t.Errorf("Wrong item %d, got: %+v want: %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRSSItemFields(t *testing.T) {
+	if !(RSSGUID{Value: "https://example.com/1"}).PermaLink() {
+		t.Errorf("GUID without isPermaLink must be a permalink")
+	}
+	if (RSSGUID{Value: "1", IsPermaLink: "false"}).PermaLink() {
+		t.Errorf("GUID with isPermaLink=false must not be a permalink")
+	}
+	item := RSSItem{Author: "jane@example.com (Jane Doe)", Creator: " Jane Doe "}
+	if got := item.ItemAuthor(); got != "Jane Doe" {
+		t.Errorf("Wrong item author, got: %v want: Jane Doe", got)
+	}
+}
+
+func TestParseFeedMislabeledContentType(t *testing.T) {
+	// an Atom document served as RSS must still be parsed as Atom
+	parser, err := selectFeedParser("application/rss+xml", readFixture(t, "atom.xml"))
+	if err != nil {
+		t.Fatalf("Failed to select a parser: %v", err)
+	}
+	if parser.name != "Atom 1.0" {
+		t.Errorf("Wrong parser, got: %v want: Atom 1.0", parser.name)
+	}
+}
+
+func TestParseFeedUnsupportedFormat(t *testing.T) {
+	documents := map[string]string{
+		"html":       "<!DOCTYPE html><html><body>Not a feed</body></html>",
+		"plain json": `{"title": "Not a feed"}`,
+		"empty":      "",
+	}
+	for name, doc := range documents {
+		_, err := parseFeed("text/html", []byte(doc))
+		if err == nil {
+			t.Errorf("Expected an error for %v document, got none", name)
+		}
+	}
+}
+
+func TestFeedToUTF8(t *testing.T) {
+	// "Café" in ISO-8859-1
+	latin1 := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><rss version=\"2.0\"><channel><title>Caf\xe9</title></channel></rss>")
+	tests := map[string]struct {
+		contentType string
+		dat         []byte
+	}{
+		"charset from prolog":       {"application/rss+xml", latin1},
+		"charset from Content-Type": {"application/rss+xml; charset=windows-1252", bytes.Replace(latin1, []byte(` encoding="ISO-8859-1"`), nil, 1)},
+		"Content-Type wins":         {"text/xml; charset=iso-8859-1", bytes.Replace(latin1, []byte("ISO-8859-1"), []byte("UTF-8"), 1)},
+		"UTF-8 with BOM":            {"", []byte("\xef\xbb\xbf<?xml version=\"1.0\" encoding=\"UTF-8\"?><rss version=\"2.0\"><channel><title>Café</title></channel></rss>")},
+	}
+	for name, tc := range tests {
+		rssFeed, err := parseFeed(tc.contentType, tc.dat)
+		if err != nil {
+			t.Errorf("%v: failed to parse feed: %v", name, err)
+			continue
+		}
+		if rssFeed.Channel.Title != "Café" {
+			t.Errorf("%v: wrong title, got: %q want: %q", name, rssFeed.Channel.Title, "Café")
+		}
+	}
+
+	if _, err := feedToUTF8("text/xml; charset=no-such-charset", latin1); err == nil {
+		t.Errorf("Expected an error for an unknown charset, got none")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "encoding/xml"
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+func init() {
+	registerFeedParser(feedParser{
+		name:         "RSS 1.0",
+		contentTypes: []string{"application/rdf+xml"},
+		sniff: func(dat []byte) bool {
+			root, err := xmlRootElement(dat)
+			return err == nil && root.Local == "RDF" && root.Space == rdfNamespace
+		},
+		parse: parseRDFFeed,
+	})
+}
+
+// RSS 1.0 documents are RDF, their items are siblings of the channel
+// instead of being nested in it
+type RDFFeed struct {
+	Channel struct {
+		Title           string `xml:"title"`
+		Link            string `xml:"link"`
+		UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subjects    []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+func parseRDFFeed(dat []byte) (RSSFeed, error) {
+	rdfFeed := RDFFeed{}
+	err := xml.Unmarshal(dat, &rdfFeed)
+	if err != nil {
+		return RSSFeed{}, err
+	}
+
+	// normalize the RDF document into the RSS shape used by the scraper
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.Title = rdfFeed.Channel.Title
+	rssFeed.Channel.Link = rdfFeed.Channel.Link
+	rssFeed.Channel.UpdatePeriod = rdfFeed.Channel.UpdatePeriod
+	rssFeed.Channel.UpdateFrequency = rdfFeed.Channel.UpdateFrequency
+	for _, item := range rdfFeed.Item {
+		rssFeed.Channel.Item = append(rssFeed.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        RSSGUID{Value: item.About, IsPermaLink: "false"},
+			DCDate:      item.Date,
+			Description: item.Description,
+			Content:     item.Content,
+			Creator:     item.Creator,
+			Categories:  item.Subjects,
+		})
+	}
+	return rssFeed, nil
+}
@@ -1,48 +1,103 @@
 package main
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"io"
-	"net/http"
-	"time"
+	"strings"
 )
 
+func init() {
+	registerFeedParser(feedParser{
+		name:         "RSS 2.0",
+		contentTypes: []string{"application/rss+xml"},
+		sniff: func(dat []byte) bool {
+			root, err := xmlRootElement(dat)
+			return err == nil && root.Local == "rss"
+		},
+		parse: parseRSSFeed,
+	})
+}
+
 type RSSFeed struct {
 	Channel struct {
 		Title string    `xml:"title"`
 		Link  string    `xml:"link"`
 		Item  []RSSItem `xml:"item"`
+		// refresh hints of the feed
+		TTL             string   `xml:"ttl"`
+		SkipHours       []string `xml:"skipHours>hour"`
+		SkipDays        []string `xml:"skipDays>day"`
+		UpdatePeriod    string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+		UpdateFrequency string   `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title   string `xml:"title"`
-	Link    string `xml:"link"`
-	PubDate string `xml:"pubDate"`
+	Title       string         `xml:"title"`
+	Link        string         `xml:"link"`
+	PubDate     string         `xml:"pubDate"`
+	GUID        RSSGUID        `xml:"guid"`
+	Updated     string         `xml:"http://www.w3.org/2005/Atom updated"`
+	DCDate      string         `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string         `xml:"description"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Author      string         `xml:"author"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string       `xml:"category"`
+	Comments    string         `xml:"comments"`
+	Enclosures  []RSSEnclosure `xml:"enclosure"`
 }
 
-func fetchFeedFromUrl(url string) (RSSFeed, error) {
-	// HTTP client to fetch the feed from the URL
-	httpClient := http.Client{
-		Timeout: 10 * time.Second,
-	}
+type RSSGUID struct {
+	Value string `xml:",chardata"`
+	// "true" or "false", a GUID without it is a permalink as per the spec
+	IsPermaLink string `xml:"isPermaLink,attr"`
+}
 
-	resp, err := httpClient.Get(url)
-	if err != nil {
-		return RSSFeed{}, err
-	}
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
 
-	defer resp.Body.Close()
-	dat, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return RSSFeed{}, err
+// PermaLink reports whether the GUID is the URL of the item
+func (guid RSSGUID) PermaLink() bool {
+	return guid.Value != "" && !strings.EqualFold(strings.TrimSpace(guid.IsPermaLink), "false")
+}
+
+// ItemAuthor returns the dc:creator of an item, or its author
+// (usually an email address) if it has none
+func (item RSSItem) ItemAuthor() string {
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
 	}
+	return strings.TrimSpace(item.Author)
+}
 
+func parseRSSFeed(dat []byte) (RSSFeed, error) {
 	rssFeed := RSSFeed{}
-	err = xml.Unmarshal(dat, &rssFeed)
+	err := xml.Unmarshal(dat, &rssFeed)
 	if err != nil {
 		return RSSFeed{}, err
 	}
-
 	return rssFeed, nil
 }
+
+// xmlRootElement returns the name of the first element in an XML document
+func xmlRootElement(dat []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(dat))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return xml.Name{}, errors.New("no root element found in the feed document")
+			}
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// feeds aren't left unfetched for longer than this, whatever they ask for
+const maxRefreshInterval = 24 * time.Hour
+
+// refreshHints holds what a feed declares about how often it should be
+// fetched, in its <ttl>, <skipHours>, <skipDays> and Syndication module
+// elements
+type refreshHints struct {
+	Interval  time.Duration
+	SkipHours []int32
+	SkipDays  []string
+}
+
+// update periods of the Syndication module
+var syUpdatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// channelRefreshHints extracts the refresh hints declared by a fetched feed
+func channelRefreshHints(rssFeed RSSFeed) refreshHints {
+	channel := rssFeed.Channel
+	hints := refreshHints{SkipHours: []int32{}, SkipDays: []string{}}
+
+	// <ttl> is the number of minutes the feed may be cached for
+	if ttl, err := strconv.Atoi(strings.TrimSpace(channel.TTL)); err == nil && ttl > 0 {
+		hints.Interval = time.Duration(ttl) * time.Minute
+	}
+
+	// sy:updatePeriod is divided into sy:updateFrequency updates
+	if period, ok := syUpdatePeriods[strings.ToLower(strings.TrimSpace(channel.UpdatePeriod))]; ok {
+		frequency, err := strconv.Atoi(strings.TrimSpace(channel.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		if interval := period / time.Duration(frequency); interval > hints.Interval {
+			hints.Interval = interval
+		}
+	}
+
+	// <skipHours> are hours of the day in GMT, 24 is sometimes used for midnight
+	for _, hourStr := range channel.SkipHours {
+		hour, err := strconv.Atoi(strings.TrimSpace(hourStr))
+		if err != nil || hour < 0 || hour > 24 {
+			continue
+		}
+		hints.SkipHours = append(hints.SkipHours, int32(hour%24))
+	}
+
+	for _, day := range channel.SkipDays {
+		if weekday, ok := parseWeekday(day); ok {
+			hints.SkipDays = append(hints.SkipDays, weekday.String())
+		}
+	}
+	return hints
+}
+
+// feedRefreshHints returns the refresh hints stored with a feed
+func feedRefreshHints(feed database.Feed) refreshHints {
+	return refreshHints{
+		Interval:  time.Duration(feed.RefreshIntervalSeconds.Int32) * time.Second,
+		SkipHours: feed.SkipHours,
+		SkipDays:  feed.SkipDays,
+	}
+}
+
+// nextFetchAt returns when a feed should be fetched next, given its refresh
+// hints and the max-age of its last response. Feeds are never fetched again
+// before the minimum interval, which is all the time feeds that declare
+// neither wait.
+func nextFetchAt(now time.Time, hints refreshHints, maxAge time.Duration, minInterval time.Duration) time.Time {
+	interval := hints.Interval
+	if maxAge > interval {
+		interval = maxAge
+	}
+	if interval < minInterval {
+		interval = minInterval
+	}
+	if interval > maxRefreshInterval {
+		interval = maxRefreshInterval
+	}
+	next := now.UTC().Add(interval)
+
+	// move the fetch out of the hours and days the feed asked to be skipped,
+	// a week of hours is enough to get out of any combination of them
+	for i := 0; i < 7*24 && isSkipped(next, hints); i++ {
+		next = next.Truncate(time.Hour).Add(time.Hour)
+	}
+	return next
+}
+
+func isSkipped(t time.Time, hints refreshHints) bool {
+	for _, hour := range hints.SkipHours {
+		if int32(t.Hour()) == hour {
+			return true
+		}
+	}
+	for _, day := range hints.SkipDays {
+		if t.Weekday().String() == day {
+			return true
+		}
+	}
+	return false
+}
+
+func parseWeekday(day string) (time.Weekday, bool) {
+	day = strings.TrimSpace(day)
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String(), day) {
+			return weekday, true
+		}
+	}
+	return time.Sunday, false
+}
+
+// cacheMaxAge returns the max-age of a response from its Cache-Control header
+func cacheMaxAge(header http.Header) time.Duration {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// parseRetryAfter returns the time from a Retry-After header, which holds
+// either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	var retryAt time.Time
+	if seconds, err := strconv.Atoi(value); err == nil {
+		retryAt = now.Add(time.Duration(seconds) * time.Second)
+	} else if t, err := http.ParseTime(value); err == nil {
+		retryAt = t
+	} else {
+		return time.Time{}
+	}
+	if retryAt.After(now.Add(maxRefreshInterval)) {
+		retryAt = now.Add(maxRefreshInterval)
+	}
+	return retryAt.UTC()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestChannelRefreshHints(t *testing.T) {
+	rssFeed := RSSFeed{}
+	rssFeed.Channel.TTL = "60"
+	rssFeed.Channel.UpdatePeriod = "daily"
+	rssFeed.Channel.UpdateFrequency = "4"
+	rssFeed.Channel.SkipHours = []string{"0", " 1 ", "24", "25", "x"}
+	rssFeed.Channel.SkipDays = []string{"Saturday", "sunday", "Someday"}
+
+	hints := channelRefreshHints(rssFeed)
+	// the longer of ttl (1h) and the syndication period (24h / 4)
+	if hints.Interval != 6*time.Hour {
+		t.Errorf("Wrong interval, got: %v want: 6h", hints.Interval)
+	}
+	if len(hints.SkipHours) != 3 || hints.SkipHours[2] != 0 {
+		t.Errorf("Wrong skip hours, got: %v want: [0 1 0]", hints.SkipHours)
+	}
+	if len(hints.SkipDays) != 2 || hints.SkipDays[1] != "Sunday" {
+		t.Errorf("Wrong skip days, got: %v want: [Saturday Sunday]", hints.SkipDays)
+	}
+}
+
+func TestNextFetchAt(t *testing.T) {
+	// a Friday
+	now := time.Date(2024, time.January, 5, 10, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		hints  refreshHints
+		maxAge time.Duration
+		want   time.Time
+	}{
+		{"no hints", refreshHints{}, 0, now.Add(time.Minute)},
+		{"ttl", refreshHints{Interval: time.Hour}, 0, now.Add(time.Hour)},
+		{"ttl shorter than the minimum", refreshHints{Interval: 30 * time.Second}, 10 * time.Second, now.Add(time.Minute)},
+		{"max-age longer than ttl", refreshHints{Interval: time.Hour}, 2 * time.Hour, now.Add(2 * time.Hour)},
+		{"capped", refreshHints{Interval: 365 * 24 * time.Hour}, 0, now.Add(maxRefreshInterval)},
+		{"skip hours", refreshHints{Interval: time.Hour, SkipHours: []int32{11, 12}}, 0, time.Date(2024, time.January, 5, 13, 0, 0, 0, time.UTC)},
+		{"skip days", refreshHints{Interval: 24 * time.Hour, SkipDays: []string{"Saturday", "Sunday"}}, 0, time.Date(2024, time.January, 8, 0, 0, 0, 0, time.UTC)},
+		{"skip current hour", refreshHints{SkipHours: []int32{10}}, 0, time.Date(2024, time.January, 5, 11, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		if got := nextFetchAt(now, tc.hints, tc.maxAge, time.Minute); !got.Equal(tc.want) {
+			t.Errorf("%s: got: %v want: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRetryAfterAndMaxAge(t *testing.T) {
+	now := time.Date(2024, time.January, 5, 10, 30, 0, 0, time.UTC)
+	if got := parseRetryAfter("120", now); !got.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("Wrong Retry-After in seconds, got: %v", got)
+	}
+	if got := parseRetryAfter("Fri, 05 Jan 2024 12:00:00 GMT", now); !got.Equal(time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong Retry-After date, got: %v", got)
+	}
+	if got := parseRetryAfter("soon", now); !got.IsZero() {
+		t.Errorf("Expected no Retry-After for an invalid value, got: %v", got)
+	}
+
+	header := http.Header{}
+	header.Set("Cache-Control", "public, max-age=1800")
+	if got := cacheMaxAge(header); got != 30*time.Minute {
+		t.Errorf("Wrong max-age, got: %v want: 30m", got)
+	}
+}
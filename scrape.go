@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
-	"log"
-	"strings"
+	"database/sql"
+	"errors"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"os"
 	"sync"
 	"time"
 
@@ -11,68 +15,295 @@ import (
 	"github.com/hammadzf/scraperss/internal/database"
 )
 
-func startScraping(db *database.Queries, concurrency int, interval time.Duration) {
-	log.Printf("Scraping feeds using %v goroutines every %v duration", concurrency, interval)
-	// start a time ticker
+// metrics of the scraper, published on /debug/vars
+var (
+	// feeds leased for scraping that no worker started on yet
+	scraperQueueDepth = expvar.NewInt("scraper_queue_depth")
+	scraperInFlight   = expvar.NewInt("scraper_in_flight")
+	scraperScraped    = expvar.NewInt("scraper_feeds_scraped")
+)
+
+// scraper fetches feeds and saves their posts
+type scraper struct {
+	conn    *sql.DB
+	db      *database.Queries
+	fetcher *feedFetcher
+	hosts   *hostLimiter
+	// owner of the leases taken on feeds by this scraper, unique per process
+	leaseOwner    string
+	leaseDuration time.Duration
+	// minimum time between fetches of a feed
+	interval time.Duration
+}
+
+// startScraping runs a pool of workers scraping due feeds until ctx is
+// cancelled. Feeds that are being scraped when ctx is cancelled are
+// finished, unless that takes longer than drainTimeout.
+func startScraping(ctx context.Context, conn *sql.DB, fetcher *feedFetcher, cfg scraperConfig, drainTimeout time.Duration) {
+	s := &scraper{
+		conn:    conn,
+		db:      database.New(conn),
+		fetcher: fetcher,
+		hosts: newHostLimiter(hostLimits{
+			Concurrency: cfg.PerHostConcurrency,
+			Rate:        cfg.PerHostRate,
+			Burst:       cfg.PerHostBurst,
+		}, cfg.Hosts),
+		leaseOwner:    newLeaseOwner(),
+		leaseDuration: cfg.LeaseDuration,
+		interval:      cfg.Interval,
+	}
+	slog.Info("Scraping feeds", "workers", cfg.Concurrency, "per host", cfg.PerHostConcurrency, "interval", cfg.Interval, "owner", s.leaseOwner)
+	// context for scraping feeds, which outlives ctx for the drain timeout
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	stopDrain := context.AfterFunc(ctx, func() {
+		time.AfterFunc(drainTimeout, cancelWork)
+	})
+	defer stopDrain()
+
+	// the queue holds as many feeds as there are workers, so that a worker
+	// finds the next feed waiting when it's done with one
+	queue := make(chan database.Feed, cfg.Concurrency)
+	// signalled by workers when they take a feed from the queue
+	dequeued := make(chan struct{}, 1)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go s.worker(ctx, workCtx, wg, queue, dequeued)
+	}
+
+	s.dispatch(ctx, queue, dequeued, cfg.Interval)
+	close(queue)
+	wg.Wait()
+	slog.Info("Stopped scraping feeds")
+}
+
+// dispatch keeps the queue filled with due feeds until ctx is cancelled. When
+// no feeds are due, it checks for due feeds again every interval.
+func (s *scraper) dispatch(ctx context.Context, queue chan<- database.Feed, dequeued <-chan struct{}, interval time.Duration) {
 	ticker := time.NewTicker(interval)
-	for ; ; <-ticker.C {
-		// get next feeds to fetch
-		feeds, err := db.GetNextFeedsToFetch(context.Background(), int32(concurrency))
-		if err != nil {
-			log.Printf("couldn't fetch feeds: %v", err)
-			continue
+	defer ticker.Stop()
+	for {
+		// feeds deferred until their host is free are leased too and count
+		// against the queue, so leases don't pile up behind a busy host
+		free := cap(queue) - len(queue) - s.hosts.deferredCount()
+		claimed := 0
+		if free > 0 {
+			// lease the next feeds to fetch, other replicas skip them
+			feeds, err := s.db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+				LeaseOwner:   s.leaseOwner,
+				LeaseSeconds: int32(s.leaseDuration.Seconds()),
+				Limit:        int32(free),
+			})
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Couldn't get feeds to fetch", "error", err)
+			}
+			// only the dispatcher sends, so there is room for all of them
+			for _, feed := range feeds {
+				scraperQueueDepth.Add(1)
+				queue <- feed
+			}
+			claimed = len(feeds)
 		}
-		// start go routines to scrape feeds in parallel
-		wg := &sync.WaitGroup{}
-		for _, feed := range feeds {
-			wg.Add(1)
-			go scrapeFeed(db, wg, feed)
+
+		if claimed < free {
+			// no more feeds are due, wait for the next check
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		} else {
+			// more feeds may be due, wait for room in the queue
+			select {
+			case <-ctx.Done():
+				return
+			case <-dequeued:
+			case <-ticker.C:
+			}
 		}
-		wg.Wait()
 	}
 }
 
-func scrapeFeed(db *database.Queries, wg *sync.WaitGroup, feed database.Feed) {
+// worker scrapes the feeds from the queue until it is closed. Feeds taken
+// from the queue after ctx is cancelled aren't scraped but given back.
+func (s *scraper) worker(ctx context.Context, workCtx context.Context, wg *sync.WaitGroup, queue <-chan database.Feed, dequeued chan<- struct{}) {
 	defer wg.Done()
-	// fetch feed and mark feed as fetched
-	_, err := db.MarkFeedAsFetched(context.Background(), feed.ID)
-	if err != nil {
-		log.Printf("Error marking the feed as fetched: %v", err)
+	for feed := range queue {
+		select {
+		case dequeued <- struct{}{}:
+		default:
+		}
+		host := s.hosts.key(feed.Url)
+		if !s.hosts.acquire(host, feed) {
+			// the feed is scraped by the worker releasing the host
+			continue
+		}
+		for {
+			scraperQueueDepth.Add(-1)
+			s.scrapeFeedPolitely(ctx, workCtx, host, feed)
+			next, ok := s.hosts.release(host)
+			if !ok {
+				break
+			}
+			feed = next
+		}
+	}
+}
+
+// scrapeFeedPolitely scrapes a feed once the rate limit of its host allows
+// it. Feeds that would have to wait long are scheduled for later instead.
+func (s *scraper) scrapeFeedPolitely(ctx context.Context, workCtx context.Context, host string, feed database.Feed) {
+	if ctx.Err() != nil {
+		s.releaseLease(feed)
 		return
 	}
-	// fetch feed from url
-	rssFeed, err := fetchFeedFromUrl(feed.Url)
-	if err != nil {
-		log.Printf("couldn't fetch feed from its url: %v", err)
+	wait := s.hosts.reserve(host, time.Now())
+	if wait > maxHostRateWait {
+		s.hosts.cancel(host)
+		s.deferFeed(feed, time.Now().UTC().Add(wait))
 		return
 	}
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.releaseLease(feed)
+			return
+		case <-timer.C:
+		}
+	}
+	scraperInFlight.Add(1)
+	s.scrapeFeed(workCtx, feed)
+	scraperInFlight.Add(-1)
+	scraperScraped.Add(1)
+}
 
-	// parse through all items on the RSS channel
-	// and save them as individual posts in DB
-	for _, item := range rssFeed.Channel.Item {
-		pubAt, err := time.Parse(time.RFC1123, item.PubDate)
-		if err != nil {
-			log.Printf("Error parsing pubDate %v with error: %v", item.PubDate, err)
-			continue
+// newLeaseOwner returns an ID for the leases of this process, the hostname
+// tells replicas apart in the DB
+func newLeaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "scraperss"
+	}
+	return hostname + "-" + uuid.NewString()[:8]
+}
+
+// scrapeFeed fetches a leased feed and saves its posts. The lease is released
+// by saving the outcome of the fetch.
+func (s *scraper) scrapeFeed(ctx context.Context, feed database.Feed) {
+	// fetch feed from url, unless it didn't change since the last fetch
+	fetched, err := s.fetcher.fetch(ctx, feed.Url, feedCacheState{
+		ETag:         feed.Etag.String,
+		LastModified: feed.LastModified.String,
+		ContentHash:  feed.ContentHash.String,
+	})
+	if err != nil {
+		slog.Warn("Couldn't fetch feed from its url", "feed", feed.Name, "url", feed.Url, "kind", fetchErrorKind(err), "error", err)
+		// fetches aborted by a shutdown are not the feed's fault
+		if ctx.Err() != nil {
+			s.releaseLease(feed)
+			return
 		}
-		_, err = db.CreatePost(context.Background(), database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now().UTC(),
-			UpdatedAt:   time.Now().UTC(),
-			Title:       item.Title,
-			PublishedAt: pubAt,
-			Url:         item.Link,
-			FeedID:      feed.ID,
-		})
-		if err != nil {
-			if strings.Contains(err.Error(), "duplicate key") {
-				// post already exists in the DB
-				continue
-			}
-			log.Printf("Couldn't create post: %v", err)
+		s.markFeedFetchFailed(ctx, feed, err)
+		return
+	}
+	// schedule the next fetch as asked for by the feed, the refresh hints
+	// are only part of the document if it was downloaded
+	hints := feedRefreshHints(feed)
+	if !fetched.NotModified {
+		hints = channelRefreshHints(fetched.Feed)
+	}
+	result := feedFetchResult{
+		Fetched:     fetched,
+		Hints:       hints,
+		NextFetchAt: nextFetchAt(time.Now(), hints, fetched.MaxAge, s.interval),
+	}
+
+	// save the posts of the feed and the outcome of the fetch in one go
+	saved, err := ingestFeed(ctx, s.conn, feed, s.leaseOwner, result)
+	if errors.Is(err, errLeaseLost) {
+		slog.Warn("Lease on feed expired while scraping it, dropped the fetch", "feed", feed.Name, "lease duration", s.leaseDuration)
+		return
+	}
+	if err != nil {
+		slog.Error("Couldn't save fetched feed", "feed", feed.Name, "error", err)
+		// other errors keep the feed leased, so it is retried once the lease expires
+		if ctx.Err() != nil {
+			s.releaseLease(feed)
 		}
-		log.Printf("Found post %s on feed %s", item.Title, feed.Name)
+		return
+	}
+	if fetched.NotModified {
+		slog.Debug("Feed not modified since the last fetch", "feed", feed.Name)
+		return
 	}
-	log.Printf("Collected %v posts from feed %s", len(rssFeed.Channel.Item), feed.Name)
+	slog.Info("Collected posts from feed", "posts", len(fetched.Feed.Channel.Item), "new or edited", saved, "feed", feed.Name)
+}
 
+// markFeedFetchFailed records the error of a failed fetch and schedules the
+// next attempt, feeds failing too often in a row are disabled
+func (s *scraper) markFeedFetchFailed(ctx context.Context, feed database.Feed, fetchErr error) {
+	failures := feed.ConsecutiveFailures + 1
+	nextAt := time.Now().UTC().Add(fetchBackoff(failures))
+	// wait longer if the server told us when to come back
+	var statusErr *httpStatusError
+	if errors.As(fetchErr, &statusErr) && statusErr.RetryAfter.After(nextAt) {
+		nextAt = statusErr.RetryAfter
+	}
+	// a feed that is gone for good is not fetched again
+	gone := statusErr != nil && statusErr.StatusCode == http.StatusGone
+	updated, err := s.db.MarkFeedFetchFailed(ctx, database.MarkFeedFetchFailedParams{
+		ID:          feed.ID,
+		LastError:   sql.NullString{String: fetchErr.Error(), Valid: true},
+		NextFetchAt: sql.NullTime{Time: nextAt, Valid: true},
+		Gone:        gone,
+		MaxFailures: maxFetchFailures,
+		LeaseOwner:  s.leaseOwner,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		slog.Warn("Lease on feed expired while scraping it, dropped the failed fetch", "feed", feed.Name, "lease duration", s.leaseDuration)
+		return
+	}
+	if err != nil {
+		slog.Error("Error marking the feed fetch as failed", "feed", feed.Name, "error", err)
+		return
+	}
+	if updated.GoneAt.Valid {
+		slog.Warn("Disabled feed that is gone", "feed", feed.Name, "url", feed.Url)
+	} else if updated.DisabledAt.Valid {
+		slog.Warn("Disabled feed after too many failed fetches", "feed", feed.Name, "failures", updated.ConsecutiveFailures)
+	}
+}
+
+// releaseLease gives up the lease on a feed that couldn't be scraped because
+// of a shutdown, so that another replica can pick it up right away
+func (s *scraper) releaseLease(feed database.Feed) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.db.ReleaseFeedLease(ctx, database.ReleaseFeedLeaseParams{
+		ID:         feed.ID,
+		LeaseOwner: sql.NullString{String: s.leaseOwner, Valid: true},
+	})
+	if err != nil {
+		slog.Error("Couldn't release lease on feed", "feed", feed.Name, "error", err)
+	}
+}
+
+// deferFeed gives up the lease on a feed and schedules it for later, when its
+// host is expected to accept more requests
+func (s *scraper) deferFeed(feed database.Feed, nextAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	slog.Debug("Deferring feed over the rate limit of its host", "feed", feed.Name, "until", nextAt)
+	err := s.db.DeferFeedFetch(ctx, database.DeferFeedFetchParams{
+		ID:          feed.ID,
+		NextFetchAt: sql.NullTime{Time: nextAt, Valid: true},
+		LeaseOwner:  sql.NullString{String: s.leaseOwner, Valid: true},
+	})
+	if err != nil {
+		slog.Error("Couldn't defer feed", "feed", feed.Name, "error", err)
+	}
 }
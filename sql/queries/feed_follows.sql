@@ -0,0 +1,33 @@
+-- name: CreateFeedFollow :one
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, name, folder_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (user_id, feed_id) DO NOTHING
+RETURNING *;
+
+-- name: GetFeedFollowsOfUser :many
+SELECT sqlc.embed(feed_follows), sqlc.embed(feeds), folders.name AS folder_name FROM feed_follows
+JOIN feeds ON feed_follows.feed_id = feeds.id
+LEFT JOIN folders ON feed_follows.folder_id = folders.id
+WHERE feed_follows.user_id=$1
+ORDER BY feed_follows.created_at;
+
+-- name: UpdateFeedFollowFolder :execrows
+-- moves a feed into a folder of the same user, or out of its folder
+UPDATE feed_follows
+SET folder_id=sqlc.narg('folder_id'),
+updated_at=NOW()
+WHERE user_id=sqlc.arg('user_id') AND feed_id=sqlc.arg('feed_id')
+AND (sqlc.narg('folder_id')::uuid IS NULL
+    OR EXISTS (SELECT 1 FROM folders WHERE folders.id=sqlc.narg('folder_id')::uuid AND folders.user_id=sqlc.arg('user_id')));
+
+-- name: DeleteFeedFollow :execrows
+DELETE FROM feed_follows WHERE user_id=$1 AND feed_id=$2;
+
+-- name: MoveFeedFollows :exec
+-- makes the followers of a feed follow another feed instead, users who follow
+-- both keep their follow of the other feed
+UPDATE feed_follows
+SET feed_id=sqlc.arg('to_feed_id'),
+updated_at=NOW()
+WHERE feed_id=sqlc.arg('from_feed_id')
+AND NOT EXISTS (SELECT 1 FROM feed_follows AS other WHERE other.user_id=feed_follows.user_id AND other.feed_id=sqlc.arg('to_feed_id'));
\ No newline at end of file
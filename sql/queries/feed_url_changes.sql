@@ -0,0 +1,17 @@
+-- name: CreateFeedURLChange :exec
+INSERT INTO feed_url_changes (id, created_at, feed_id, old_url, new_url)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetMovedFeedURL :one
+-- returns the current URL of the feed that moved away from a URL
+SELECT feeds.url FROM feed_url_changes
+JOIN feeds ON feeds.id = feed_url_changes.feed_id
+WHERE feed_url_changes.old_url=$1
+ORDER BY feed_url_changes.created_at DESC
+LIMIT 1;
+
+-- name: MoveFeedURLChanges :exec
+-- moves the URL history of a feed to the feed it was merged into
+UPDATE feed_url_changes
+SET feed_id=sqlc.arg('to_feed_id')
+WHERE feed_id=sqlc.arg('from_feed_id');
\ No newline at end of file
@@ -1,25 +1,112 @@
 -- name: CreateFeed :one
-INSERT INTO feeds (id, name, url, created_at, updated_at, user_id)
-VALUES ($1, $2, $3, $4, $5, $6)
+-- returns the existing feed if a feed with the URL already exists. A disabled
+-- feed is enabled again, as it's followed anew.
+INSERT INTO feeds (id, name, url, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (url) DO UPDATE SET url=EXCLUDED.url,
+disabled_at=NULL,
+gone_at=NULL,
+consecutive_failures=CASE WHEN feeds.disabled_at IS NULL THEN feeds.consecutive_failures ELSE 0 END,
+next_fetch_at=CASE WHEN feeds.disabled_at IS NULL THEN feeds.next_fetch_at ELSE NOW() END
 RETURNING *;
 
--- name: GetFeedsOfUser :many
-SELECT * FROM feeds WHERE user_id=$1;
+-- name: ClaimFeedsToFetch :many
+-- leases the feeds that are due to the given scraper. Feeds leased by other
+-- scrapers are skipped until their lease expires. next_fetch_at is only NULL
+-- for feeds that were never fetched, which go first.
+UPDATE feeds
+SET lease_owner=sqlc.arg('lease_owner')::text,
+lease_expires_at=NOW() + sqlc.arg('lease_seconds')::int * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM feeds AS due
+    WHERE due.disabled_at IS NULL
+    AND (due.next_fetch_at IS NULL OR due.next_fetch_at <= NOW())
+    AND (due.lease_expires_at IS NULL OR due.lease_expires_at <= NOW())
+    AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = due.id)
+    ORDER BY COALESCE(due.next_fetch_at, '-infinity'::timestamp) ASC, due.last_fetched_at ASC NULLS FIRST
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
 
--- name: GetFeedByURL :one
-SELECT * FROM feeds WHERE user_id=$1 AND url=$2;
+-- name: DeferFeedFetch :exec
+UPDATE feeds
+SET next_fetch_at=$2,
+lease_owner=NULL,
+lease_expires_at=NULL
+WHERE id=$1 AND lease_owner=$3;
 
--- name: DeleteFeed :exec
-DELETE FROM feeds WHERE user_id=$1 AND id=$2;
+-- name: EnableFeed :execrows
+-- enables a disabled feed the user follows again, it's fetched right away
+UPDATE feeds
+SET disabled_at=NULL,
+gone_at=NULL,
+consecutive_failures=0,
+next_fetch_at=NOW(),
+updated_at=NOW()
+WHERE id=$1
+AND EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = feeds.id AND feed_follows.user_id = $2);
 
--- name: GetNextFeedsToFetch :many
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1;
+-- name: ReleaseFeedLease :exec
+UPDATE feeds
+SET lease_owner=NULL,
+lease_expires_at=NULL
+WHERE id=$1 AND lease_owner=$2;
 
--- name: MarkFeedAsFetched :one
+-- name: MarkFeedFetchSucceeded :execrows
+-- saves the outcome of a fetch, unless the lease on the feed was lost to
+-- another scraper in the meantime
 UPDATE feeds
 SET last_fetched_at=NOW(),
+last_error=NULL,
+consecutive_failures=0,
+last_success_at=NOW(),
+lease_owner=NULL,
+lease_expires_at=NULL,
+next_fetch_at=sqlc.arg('next_fetch_at')::timestamp,
 updated_at=NOW()
-WHERE id=$1
-RETURNING *;
\ No newline at end of file
+WHERE id=sqlc.arg('id') AND lease_owner=sqlc.arg('lease_owner')::text;
+
+-- name: MarkFeedFetchFailed :one
+-- returns no rows if the lease on the feed was lost to another scraper
+UPDATE feeds
+SET last_fetched_at=NOW(),
+last_error=sqlc.arg('last_error'),
+consecutive_failures=consecutive_failures+1,
+next_fetch_at=sqlc.arg('next_fetch_at'),
+disabled_at=CASE WHEN sqlc.arg('gone')::bool OR consecutive_failures+1 >= sqlc.arg('max_failures')::int THEN NOW() ELSE disabled_at END,
+gone_at=CASE WHEN sqlc.arg('gone')::bool THEN NOW() ELSE gone_at END,
+lease_owner=NULL,
+lease_expires_at=NULL,
+updated_at=NOW()
+WHERE id=sqlc.arg('id') AND lease_owner=sqlc.arg('lease_owner')::text
+RETURNING *;
+
+-- name: UpdateFeedCacheState :exec
+UPDATE feeds
+SET etag=$2,
+last_modified=$3,
+content_hash=$4
+WHERE id=$1;
+
+-- name: UpdateFeedURL :execrows
+-- moves a feed to a new URL, unless another feed already has that URL
+UPDATE feeds
+SET url=$2,
+updated_at=NOW()
+WHERE id=$1 AND NOT EXISTS (SELECT 1 FROM feeds AS other WHERE other.url=$2);
+
+-- name: UpdateFeedRefreshHints :exec
+UPDATE feeds
+SET refresh_interval_seconds=$2,
+skip_hours=$3,
+skip_days=$4
+WHERE id=$1;
+
+-- name: GetFeedByURL :one
+SELECT * FROM feeds WHERE url=$1;
+
+-- name: DeleteMergedFeed :execrows
+-- deletes a feed that was merged into another feed, unless the lease on the
+-- feed was lost to another scraper in the meantime
+DELETE FROM feeds WHERE id=sqlc.arg('id') AND lease_owner=sqlc.arg('lease_owner')::text;
\ No newline at end of file
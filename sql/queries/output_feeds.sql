@@ -0,0 +1,20 @@
+-- name: CreateOutputFeed :one
+INSERT INTO output_feeds (id, created_at, updated_at, user_id, token, title, feed_id, folder_id, tag, keyword)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+RETURNING *;
+
+-- name: GetOutputFeedsOfUser :many
+SELECT * FROM output_feeds WHERE user_id=$1 ORDER BY created_at;
+
+-- name: GetOutputFeedByToken :one
+SELECT * FROM output_feeds WHERE token=$1;
+
+-- name: DeleteOutputFeed :execrows
+DELETE FROM output_feeds WHERE id=$1 AND user_id=$2;
+
+-- name: MoveOutputFeeds :exec
+-- makes the output feeds of the posts of a feed show the posts of another feed
+UPDATE output_feeds
+SET feed_id=sqlc.arg('to_feed_id'),
+updated_at=NOW()
+WHERE feed_id=sqlc.arg('from_feed_id');
\ No newline at end of file
@@ -1,4 +1,145 @@
 -- name: CreatePost :one
-INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
-RETURNING *;
\ No newline at end of file
+INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id, published_at_source,
+    description, content, author, categories, guid, guid_is_permalink, comments_url, item_key, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+ON CONFLICT (feed_id, item_key) DO UPDATE SET
+    updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    guid = EXCLUDED.guid,
+    guid_is_permalink = EXCLUDED.guid_is_permalink,
+    comments_url = EXCLUDED.comments_url,
+    content_hash = EXCLUDED.content_hash,
+    -- posts stored before content hashes were recorded aren't edits
+    edited_at = CASE WHEN posts.content_hash = '' THEN posts.edited_at ELSE EXCLUDED.updated_at END
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING *;
+
+-- name: CreatePostEnclosure :exec
+INSERT INTO post_enclosures (id, post_id, url, type, length)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: UpsertPosts :many
+-- inserts the posts of a feed in one statement, the arrays hold one element per post.
+-- Categories are passed as JSON arrays as Postgres has no arrays of arrays.
+INSERT INTO posts (id, created_at, updated_at, title, url, published_at, feed_id, published_at_source,
+    description, content, author, categories, guid, guid_is_permalink, comments_url, item_key, content_hash)
+SELECT i.id, sqlc.arg('created_at')::timestamp, sqlc.arg('created_at')::timestamp, i.title, i.url, i.published_at,
+    sqlc.arg('feed_id')::uuid, i.published_at_source, i.description, i.content, i.author,
+    ARRAY(SELECT jsonb_array_elements_text(i.categories::jsonb)), i.guid, i.guid_is_permalink, i.comments_url,
+    i.item_key, i.content_hash
+FROM unnest(
+    sqlc.arg('ids')::uuid[],
+    sqlc.arg('titles')::text[],
+    sqlc.arg('urls')::text[],
+    sqlc.arg('published_ats')::timestamp[],
+    sqlc.arg('published_at_sources')::text[],
+    sqlc.arg('descriptions')::text[],
+    sqlc.arg('contents')::text[],
+    sqlc.arg('authors')::text[],
+    sqlc.arg('categories')::text[],
+    sqlc.arg('guids')::text[],
+    sqlc.arg('guid_is_permalinks')::boolean[],
+    sqlc.arg('comments_urls')::text[],
+    sqlc.arg('item_keys')::text[],
+    sqlc.arg('content_hashes')::text[]
+) AS i(id, title, url, published_at, published_at_source, description, content, author, categories,
+    guid, guid_is_permalink, comments_url, item_key, content_hash)
+ON CONFLICT (feed_id, item_key) DO UPDATE SET
+    updated_at = EXCLUDED.updated_at,
+    title = EXCLUDED.title,
+    url = EXCLUDED.url,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    guid = EXCLUDED.guid,
+    guid_is_permalink = EXCLUDED.guid_is_permalink,
+    comments_url = EXCLUDED.comments_url,
+    content_hash = EXCLUDED.content_hash,
+    edited_at = CASE WHEN posts.content_hash = '' THEN posts.edited_at ELSE EXCLUDED.updated_at END
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING *;
+
+-- name: CreatePostEnclosures :exec
+INSERT INTO post_enclosures (id, post_id, url, type, length)
+SELECT i.id, i.post_id, i.url, i.type, NULLIF(i.length, 0)
+FROM unnest(
+    sqlc.arg('ids')::uuid[],
+    sqlc.arg('post_ids')::uuid[],
+    sqlc.arg('urls')::text[],
+    sqlc.arg('types')::text[],
+    sqlc.arg('lengths')::bigint[]
+) AS i(id, post_id, url, type, length)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: GetEnclosuresForPosts :many
+SELECT * FROM post_enclosures
+WHERE post_id = ANY(sqlc.arg('post_ids')::uuid[])
+ORDER BY post_id, url;
+
+-- name: GetPostsForOutputFeed :many
+-- latest posts of the feeds a user follows, filtered like an output feed
+SELECT posts.* FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg('user_id')
+AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id')::uuid)
+AND (sqlc.narg('folder_id')::uuid IS NULL OR feed_follows.folder_id = sqlc.narg('folder_id')::uuid)
+AND (sqlc.narg('tag')::text IS NULL
+    OR EXISTS (SELECT 1 FROM unnest(posts.categories) AS category WHERE lower(category) = lower(sqlc.narg('tag')::text)))
+AND (sqlc.narg('keyword')::text IS NULL
+    OR posts.title ILIKE '%' || sqlc.narg('keyword')::text || '%' ESCAPE '\'
+    OR posts.description ILIKE '%' || sqlc.narg('keyword')::text || '%' ESCAPE '\')
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostsForUser :many
+SELECT posts.* FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg('user_id')
+AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id')::uuid)
+AND (sqlc.narg('since')::timestamp IS NULL OR posts.published_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR posts.published_at < sqlc.narg('until')::timestamp)
+AND (sqlc.narg('title')::text IS NULL OR posts.title ILIKE '%' || sqlc.narg('title')::text || '%' ESCAPE '\')
+AND (sqlc.narg('read')::bool IS NULL OR COALESCE(user_post_states.read, false) = sqlc.narg('read')::bool)
+AND (sqlc.narg('starred')::bool IS NULL OR COALESCE(user_post_states.starred, false) = sqlc.narg('starred')::bool)
+AND (sqlc.narg('archived')::bool IS NULL OR COALESCE(user_post_states.archived, false) = sqlc.narg('archived')::bool)
+AND (sqlc.narg('folder_id')::uuid IS NULL OR feed_follows.folder_id = sqlc.narg('folder_id')::uuid)
+AND (sqlc.narg('cursor_published_at')::timestamp IS NULL
+    OR (posts.published_at, posts.id) < (sqlc.narg('cursor_published_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY posts.published_at DESC, posts.id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostsForUserOldestFirst :many
+SELECT posts.* FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg('user_id')
+AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id')::uuid)
+AND (sqlc.narg('since')::timestamp IS NULL OR posts.published_at >= sqlc.narg('since')::timestamp)
+AND (sqlc.narg('until')::timestamp IS NULL OR posts.published_at < sqlc.narg('until')::timestamp)
+AND (sqlc.narg('title')::text IS NULL OR posts.title ILIKE '%' || sqlc.narg('title')::text || '%' ESCAPE '\')
+AND (sqlc.narg('read')::bool IS NULL OR COALESCE(user_post_states.read, false) = sqlc.narg('read')::bool)
+AND (sqlc.narg('starred')::bool IS NULL OR COALESCE(user_post_states.starred, false) = sqlc.narg('starred')::bool)
+AND (sqlc.narg('archived')::bool IS NULL OR COALESCE(user_post_states.archived, false) = sqlc.narg('archived')::bool)
+AND (sqlc.narg('folder_id')::uuid IS NULL OR feed_follows.folder_id = sqlc.narg('folder_id')::uuid)
+AND (sqlc.narg('cursor_published_at')::timestamp IS NULL
+    OR (posts.published_at, posts.id) > (sqlc.narg('cursor_published_at')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY posts.published_at ASC, posts.id ASC
+LIMIT sqlc.arg('limit');
+
+-- name: MovePosts :exec
+-- moves the posts of a feed to another feed, except for the items the other
+-- feed has as well
+UPDATE posts
+SET feed_id=sqlc.arg('to_feed_id')
+WHERE feed_id=sqlc.arg('from_feed_id')
+AND NOT EXISTS (SELECT 1 FROM posts AS other WHERE other.feed_id=sqlc.arg('to_feed_id') AND other.item_key=posts.item_key);
\ No newline at end of file
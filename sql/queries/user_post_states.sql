@@ -0,0 +1,64 @@
+-- name: UpdatePostState :one
+-- updates the state of a post for a user following its feed, states that
+-- aren't given are kept
+INSERT INTO user_post_states (user_id, post_id, read, starred, archived, read_at, created_at, updated_at)
+SELECT feed_follows.user_id, posts.id,
+    COALESCE(sqlc.narg('read')::bool, false),
+    COALESCE(sqlc.narg('starred')::bool, false),
+    COALESCE(sqlc.narg('archived')::bool, false),
+    CASE WHEN sqlc.narg('read')::bool THEN NOW() END,
+    NOW(), NOW()
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg('user_id') AND posts.id = sqlc.arg('post_id')
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = COALESCE(sqlc.narg('read')::bool, user_post_states.read),
+starred = COALESCE(sqlc.narg('starred')::bool, user_post_states.starred),
+archived = COALESCE(sqlc.narg('archived')::bool, user_post_states.archived),
+read_at = CASE
+    WHEN sqlc.narg('read')::bool IS NULL THEN user_post_states.read_at
+    WHEN sqlc.narg('read')::bool THEN COALESCE(user_post_states.read_at, NOW())
+END,
+updated_at = NOW()
+RETURNING *;
+
+-- name: MarkPostsRead :execrows
+-- marks the posts published before a time as read, of all feeds a user
+-- follows, of one of them or of the feeds in one of their folders
+INSERT INTO user_post_states (user_id, post_id, read, read_at, created_at, updated_at)
+SELECT feed_follows.user_id, posts.id, true, NOW(), NOW(), NOW()
+FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+WHERE feed_follows.user_id = sqlc.arg('user_id')
+AND (sqlc.narg('feed_id')::uuid IS NULL OR posts.feed_id = sqlc.narg('feed_id')::uuid)
+AND (sqlc.narg('folder_id')::uuid IS NULL OR feed_follows.folder_id = sqlc.narg('folder_id')::uuid)
+AND posts.published_at < sqlc.arg('before')::timestamp
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = true,
+read_at = NOW(),
+updated_at = NOW()
+WHERE NOT user_post_states.read;
+
+-- name: GetPostStatesForPosts :many
+SELECT * FROM user_post_states
+WHERE user_id = sqlc.arg('user_id') AND post_id = ANY(sqlc.arg('post_ids')::uuid[]);
+
+-- name: GetUnreadCountsOfUser :many
+SELECT posts.feed_id, COUNT(*) AS unread FROM posts
+JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
+LEFT JOIN user_post_states ON user_post_states.post_id = posts.id
+    AND user_post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND NOT COALESCE(user_post_states.read, false)
+GROUP BY posts.feed_id;
+
+-- name: CopyPostStates :exec
+-- copies the states users gave the posts of a feed to the posts of another
+-- feed with the same items, states given to those already are kept
+INSERT INTO user_post_states (user_id, post_id, read, starred, archived, read_at, created_at, updated_at)
+SELECT states.user_id, other.id, states.read, states.starred, states.archived, states.read_at, states.created_at, states.updated_at
+FROM user_post_states AS states
+JOIN posts ON posts.id = states.post_id
+JOIN posts AS other ON other.feed_id=sqlc.arg('to_feed_id') AND other.item_key = posts.item_key
+WHERE posts.feed_id=sqlc.arg('from_feed_id')
+ON CONFLICT (user_id, post_id) DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,102 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (id, created_at, updated_at, user_id, url, secret, feed_ids, keywords)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING *;
+
+-- name: GetWebhooksOfUser :many
+SELECT * FROM webhooks WHERE user_id=$1 ORDER BY created_at;
+
+-- name: GetWebhookByID :one
+SELECT * FROM webhooks WHERE id=$1;
+
+-- name: DeleteWebhook :execrows
+DELETE FROM webhooks WHERE id=$1 AND user_id=$2;
+
+-- name: GetWebhooksForFeed :many
+-- webhooks of the users following a feed, which the posts of the feed are sent to
+SELECT webhooks.* FROM webhooks
+JOIN feed_follows ON feed_follows.user_id = webhooks.user_id
+WHERE feed_follows.feed_id = $1
+AND (cardinality(webhooks.feed_ids) = 0 OR $1 = ANY(webhooks.feed_ids));
+
+-- name: CreateWebhookDeliveries :exec
+-- queues deliveries to webhooks in one statement, the arrays hold one element
+-- per delivery
+INSERT INTO webhook_deliveries (id, created_at, webhook_id, post_id, payload, status, next_attempt_at)
+SELECT i.id, sqlc.arg('created_at')::timestamp, i.webhook_id, i.post_id, i.payload, 'pending', sqlc.arg('created_at')::timestamp
+FROM unnest(
+    sqlc.arg('ids')::uuid[],
+    sqlc.arg('webhook_ids')::uuid[],
+    sqlc.arg('post_ids')::uuid[],
+    sqlc.arg('payloads')::text[]
+) AS i(id, webhook_id, post_id, payload);
+
+-- name: ClaimWebhookDeliveries :many
+-- leases the deliveries that are due, deliveries leased by other replicas are
+-- skipped until their lease expires
+UPDATE webhook_deliveries
+SET lease_expires_at=NOW() + sqlc.arg('lease_seconds')::int * INTERVAL '1 second'
+WHERE id IN (
+    SELECT id FROM webhook_deliveries AS due
+    WHERE due.status = 'pending'
+    AND due.next_attempt_at <= NOW()
+    AND (due.lease_expires_at IS NULL OR due.lease_expires_at <= NOW())
+    ORDER BY due.next_attempt_at ASC
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkWebhookDeliveryDelivered :exec
+UPDATE webhook_deliveries
+SET status='delivered',
+attempts=attempts + 1,
+last_attempt_at=NOW(),
+delivered_at=NOW(),
+lease_expires_at=NULL
+WHERE id=$1;
+
+-- name: MarkWebhookDeliveryFailed :one
+-- schedules the next attempt of a failed delivery, deliveries failing too
+-- often are given up
+UPDATE webhook_deliveries
+SET attempts=attempts + 1,
+last_attempt_at=NOW(),
+next_attempt_at=sqlc.arg('next_attempt_at'),
+status=CASE WHEN attempts + 1 >= sqlc.arg('max_attempts')::int THEN 'failed' ELSE 'pending' END,
+lease_expires_at=NULL
+WHERE id=sqlc.arg('id')
+RETURNING *;
+
+-- name: RedeliverWebhookDelivery :one
+-- queues a delivery of a webhook of the user again, with a fresh set of attempts
+UPDATE webhook_deliveries
+SET status='pending',
+attempts=0,
+next_attempt_at=NOW(),
+lease_expires_at=NULL
+WHERE webhook_deliveries.id=sqlc.arg('id')
+AND webhook_id IN (SELECT webhooks.id FROM webhooks WHERE webhooks.id=sqlc.arg('webhook_id') AND webhooks.user_id=sqlc.arg('user_id'))
+RETURNING *;
+
+-- name: GetDeliveriesOfWebhook :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id=$1
+ORDER BY created_at DESC
+LIMIT $2;
+
+-- name: CreateWebhookDeliveryAttempt :exec
+INSERT INTO webhook_delivery_attempts (id, created_at, delivery_id, status_code, error, duration_ms)
+VALUES ($1, $2, $3, $4, $5, $6);
+
+-- name: GetAttemptsForDeliveries :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = ANY(sqlc.arg('delivery_ids')::uuid[])
+ORDER BY created_at;
+
+-- name: ReplaceWebhookFeed :exec
+-- replaces a feed with another feed in the feeds webhooks are limited to
+UPDATE webhooks
+SET feed_ids=ARRAY(SELECT DISTINCT unnest(array_replace(feed_ids, sqlc.arg('from_feed_id')::uuid, sqlc.arg('to_feed_id')::uuid))),
+updated_at=NOW()
+WHERE sqlc.arg('from_feed_id')::uuid = ANY(feed_ids);
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN published_at_source TEXT NOT NULL DEFAULT 'published';
+
+-- +goose Down
+ALTER TABLE posts DROP COLUMN published_at_source;
\ No newline at end of file
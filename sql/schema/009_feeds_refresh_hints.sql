@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE feeds ADD COLUMN refresh_interval_seconds INTEGER;
+ALTER TABLE feeds ADD COLUMN skip_hours INTEGER[] NOT NULL DEFAULT '{}';
+ALTER TABLE feeds ADD COLUMN skip_days TEXT[] NOT NULL DEFAULT '{}';
+CREATE INDEX feeds_next_fetch_at_idx ON feeds (next_fetch_at) WHERE disabled_at IS NULL;
+
+-- +goose Down
+DROP INDEX feeds_next_fetch_at_idx;
+ALTER TABLE feeds DROP COLUMN skip_days;
+ALTER TABLE feeds DROP COLUMN skip_hours;
+ALTER TABLE feeds DROP COLUMN refresh_interval_seconds;
\ No newline at end of file
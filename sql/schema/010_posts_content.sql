@@ -0,0 +1,27 @@
+-- +goose Up
+ALTER TABLE posts ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN content TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN author TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE posts ADD COLUMN guid TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN guid_is_permalink BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE posts ADD COLUMN comments_url TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE post_enclosures (
+    id UUID PRIMARY KEY,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    type TEXT NOT NULL,
+    length BIGINT,
+    UNIQUE (post_id, url)
+);
+
+-- +goose Down
+DROP TABLE post_enclosures;
+ALTER TABLE posts DROP COLUMN comments_url;
+ALTER TABLE posts DROP COLUMN guid_is_permalink;
+ALTER TABLE posts DROP COLUMN guid;
+ALTER TABLE posts DROP COLUMN categories;
+ALTER TABLE posts DROP COLUMN author;
+ALTER TABLE posts DROP COLUMN content;
+ALTER TABLE posts DROP COLUMN description;
\ No newline at end of file
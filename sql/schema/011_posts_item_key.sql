@@ -0,0 +1,18 @@
+-- +goose Up
+-- posts are identified per feed by their GUID, canonical link or content hash.
+-- The raw keys set here are canonicalized by the Go migration 019.
+ALTER TABLE posts ADD COLUMN item_key TEXT;
+UPDATE posts SET item_key = CASE WHEN guid <> '' THEN 'guid:' || guid ELSE 'link:' || url END;
+ALTER TABLE posts ALTER COLUMN item_key SET NOT NULL;
+ALTER TABLE posts ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE posts ADD COLUMN edited_at TIMESTAMP;
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_item_key_key UNIQUE (feed_id, item_key);
+
+-- +goose Down
+ALTER TABLE posts DROP CONSTRAINT posts_feed_id_item_key_key;
+DELETE FROM posts a USING posts b WHERE a.url = b.url AND a.created_at > b.created_at;
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+ALTER TABLE posts DROP COLUMN edited_at;
+ALTER TABLE posts DROP COLUMN content_hash;
+ALTER TABLE posts DROP COLUMN item_key;
\ No newline at end of file
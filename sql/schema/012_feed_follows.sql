@@ -0,0 +1,27 @@
+-- +goose Up
+-- feeds are shared by all users, who subscribe to them by following them
+CREATE TABLE feed_follows (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    UNIQUE (user_id, feed_id)
+);
+
+INSERT INTO feed_follows (id, created_at, updated_at, user_id, feed_id, name)
+SELECT gen_random_uuid(), created_at, updated_at, user_id, id, name FROM feeds;
+
+ALTER TABLE feeds DROP COLUMN user_id;
+
+-- +goose Down
+ALTER TABLE feeds ADD COLUMN user_id UUID REFERENCES users(id) ON DELETE CASCADE;
+UPDATE feeds SET user_id = (
+    SELECT user_id FROM feed_follows
+    WHERE feed_follows.feed_id = feeds.id
+    ORDER BY created_at LIMIT 1
+);
+DELETE FROM feeds WHERE user_id IS NULL;
+ALTER TABLE feeds ALTER COLUMN user_id SET NOT NULL;
+DROP TABLE feed_follows;
\ No newline at end of file
@@ -0,0 +1,8 @@
+-- +goose Up
+-- feeds being scraped are leased by one scraper, so replicas don't fetch the same feed
+ALTER TABLE feeds ADD COLUMN lease_owner TEXT;
+ALTER TABLE feeds ADD COLUMN lease_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds DROP COLUMN lease_expires_at;
+ALTER TABLE feeds DROP COLUMN lease_owner;
\ No newline at end of file
@@ -0,0 +1,16 @@
+-- +goose Up
+-- feeds answered with 410 Gone are dead and no longer fetched
+ALTER TABLE feeds ADD COLUMN gone_at TIMESTAMP;
+
+-- previous URLs of feeds that were moved with a permanent redirect
+CREATE TABLE feed_url_changes (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    old_url TEXT NOT NULL,
+    new_url TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE feed_url_changes;
+ALTER TABLE feeds DROP COLUMN gone_at;
\ No newline at end of file
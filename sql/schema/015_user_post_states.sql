@@ -0,0 +1,18 @@
+-- +goose Up
+-- state of posts per user, posts without a state are unread
+CREATE TABLE user_post_states (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    read BOOLEAN NOT NULL DEFAULT false,
+    starred BOOLEAN NOT NULL DEFAULT false,
+    archived BOOLEAN NOT NULL DEFAULT false,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id)
+);
+
+CREATE INDEX user_post_states_post_id_idx ON user_post_states (post_id);
+
+-- +goose Down
+DROP TABLE user_post_states;
\ No newline at end of file
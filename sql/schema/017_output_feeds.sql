@@ -0,0 +1,21 @@
+-- +goose Up
+-- feeds rendered from the posts of a user, served at URLs with an unguessable
+-- token instead of an API key. The posts are filtered by the optional feed,
+-- folder, tag and keyword.
+CREATE TABLE output_feeds (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT UNIQUE NOT NULL,
+    title TEXT NOT NULL,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    folder_id UUID REFERENCES folders(id) ON DELETE CASCADE,
+    tag TEXT,
+    keyword TEXT
+);
+
+CREATE INDEX output_feeds_user_id_idx ON output_feeds (user_id);
+
+-- +goose Down
+DROP TABLE output_feeds;
\ No newline at end of file
@@ -0,0 +1,57 @@
+-- +goose Up
+-- endpoints of users that new posts are sent to, optionally only the posts of
+-- some feeds or matching some keywords
+CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    -- key of the HMAC-SHA256 signatures of the deliveries
+    secret TEXT NOT NULL,
+    -- empty for all feeds the user follows
+    feed_ids UUID[] NOT NULL DEFAULT '{}',
+    -- empty for all posts
+    keywords TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id);
+
+-- outbox of the deliveries of posts to webhooks, written in the transaction
+-- saving the posts. The payload is kept as sent, as its signature covers its
+-- exact bytes.
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+    post_id UUID REFERENCES posts(id) ON DELETE SET NULL,
+    payload TEXT NOT NULL,
+    -- pending, delivered or failed
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_attempt_at TIMESTAMP,
+    delivered_at TIMESTAMP,
+    lease_expires_at TIMESTAMP
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+
+-- log of the attempts to deliver to webhooks
+CREATE TABLE webhook_delivery_attempts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    -- NULL if no response was received
+    status_code INT,
+    error TEXT,
+    duration_ms INT NOT NULL
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_id_idx ON webhook_delivery_attempts (delivery_id);
+
+-- +goose Down
+DROP TABLE webhook_delivery_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhooks;
\ No newline at end of file
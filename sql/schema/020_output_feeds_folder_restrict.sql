@@ -0,0 +1,10 @@
+-- +goose Up
+-- output feeds of a folder would silently disappear along with it, so folders
+-- used by output feeds can't be deleted. NO ACTION is checked at the end of
+-- the statement, so deleting a user still deletes both.
+ALTER TABLE output_feeds DROP CONSTRAINT output_feeds_folder_id_fkey;
+ALTER TABLE output_feeds ADD CONSTRAINT output_feeds_folder_id_fkey FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE NO ACTION;
+
+-- +goose Down
+ALTER TABLE output_feeds DROP CONSTRAINT output_feeds_folder_id_fkey;
+ALTER TABLE output_feeds ADD CONSTRAINT output_feeds_folder_id_fkey FOREIGN KEY (folder_id) REFERENCES folders(id) ON DELETE CASCADE;
\ No newline at end of file
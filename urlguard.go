@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errUnsafeAddress = errors.New("address is not allowed")
+
+// address ranges of the internal network, which feeds must not point into
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// urlGuard keeps users from making the service fetch URLs of its own network,
+// e.g. http://localhost or cloud metadata endpoints like 169.254.169.254.
+// Hosts and address ranges of the allowlist are exempt, for intranet feeds.
+type urlGuard struct {
+	// allowed hostnames, along with their subdomains
+	allowedHosts []string
+	// allowed address ranges
+	allowedPrefixes []netip.Prefix
+	resolver        *net.Resolver
+}
+
+// newURLGuard returns a guard allowing the given hosts, which are hostnames,
+// IP addresses or CIDR ranges
+func newURLGuard(allowlist []string) *urlGuard {
+	guard := &urlGuard{resolver: net.DefaultResolver}
+	for _, entry := range allowlist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			guard.allowedPrefixes = append(guard.allowedPrefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			guard.allowedPrefixes = append(guard.allowedPrefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if entry != "" {
+			guard.allowedHosts = append(guard.allowedHosts, strings.TrimPrefix(entry, "."))
+		}
+	}
+	return guard
+}
+
+// checkURL checks that a URL given by a user is an http(s) URL whose host
+// resolves to public addresses only. The returned errors are meant for users.
+func (g *urlGuard) checkURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return errors.New("the URL is malformed")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("only http and https URLs are supported")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("the URL has no host")
+	}
+	if g.hostAllowed(host) {
+		return nil
+	}
+
+	addrs, err := g.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("the host %s couldn't be resolved", host)
+	}
+	for _, addr := range addrs {
+		if err := g.checkAddr(addr); err != nil {
+			return fmt.Errorf("the host %s points into a private network", host)
+		}
+	}
+	return nil
+}
+
+// hostAllowed reports whether a host is on the allowlist by its name
+func (g *urlGuard) hostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range g.allowedHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.addrAllowed(addr)
+	}
+	return false
+}
+
+func (g *urlGuard) addrAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range g.allowedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAddr returns errUnsafeAddress for loopback, private, link-local and
+// other non-public addresses that aren't on the allowlist
+func (g *urlGuard) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if g.addrAllowed(addr) {
+		return nil
+	}
+	blocked := !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast()
+	for _, prefix := range blockedPrefixes {
+		blocked = blocked || prefix.Contains(addr)
+	}
+	if blocked {
+		return fmt.Errorf("%w: %s", errUnsafeAddress, addr)
+	}
+	return nil
+}
+
+// dialContext dials like a net.Dialer, refusing to connect to unsafe
+// addresses. The address is checked after DNS resolution, right before
+// connecting, so a host can't resolve to a public address when its feed is
+// created and to an internal one when it's fetched.
+func (g *urlGuard) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	guarded := *dialer
+	guarded.Control = func(network, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", errUnsafeAddress, address)
+		}
+		return g.checkAddr(addrPort.Addr())
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && g.hostAllowed(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
+
+// transport returns a transport of http.DefaultTransport's settings that
+// dials through the guard. It ignores HTTP_PROXY and HTTPS_PROXY: through a
+// proxy, the guard would only ever see the address of the proxy, not the
+// addresses of the URLs and their redirects.
+func (g *urlGuard) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = g.dialContext(&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	})
+	return transport
+}
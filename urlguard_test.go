@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestURLGuardCheckURL(t *testing.T) {
+	guard := newURLGuard(nil)
+	tests := map[string]bool{
+		"https://93.184.216.34/feed.xml":       true,
+		"http://[2606:2800:220:1::]/feed.xml":  true,
+		"file:///etc/passwd":                   false,
+		"ftp://93.184.216.34/feed.xml":         false,
+		"https:///feed.xml":                    false,
+		"http://localhost/feed.xml":            false,
+		"http://127.0.0.1:8080/feed.xml":       false,
+		"http://[::1]/feed.xml":                false,
+		"http://[::ffff:127.0.0.1]/feed.xml":   false,
+		"http://169.254.169.254/latest/":       false,
+		"http://10.0.0.1/feed.xml":             false,
+		"http://172.16.0.1/feed.xml":           false,
+		"http://192.168.1.1/feed.xml":          false,
+		"http://100.64.0.1/feed.xml":           false,
+		"http://0.0.0.0/feed.xml":              false,
+		"http://[fd00::1]/feed.xml":            false,
+		"http://[fe80::1]/feed.xml":            false,
+		"http://[64:ff9b::a9fe:a9fe]/feed.xml": false,
+	}
+	for feedURL, wantOK := range tests {
+		err := guard.checkURL(context.Background(), feedURL)
+		if (err == nil) != wantOK {
+			t.Errorf("Wrong result for %v, got error: %v want allowed: %v", feedURL, err, wantOK)
+		}
+	}
+}
+
+func TestURLGuardAllowlist(t *testing.T) {
+	guard := newURLGuard([]string{"10.0.0.0/8", "192.168.1.1", "Intranet.example"})
+	tests := map[string]bool{
+		"http://10.1.2.3/feed.xml":                true,
+		"http://192.168.1.1/feed.xml":             true,
+		"http://192.168.1.2/feed.xml":             false,
+		"http://intranet.example/feed.xml":        true,
+		"http://feeds.intranet.example/feed.xml":  true,
+		"http://notintranet.example.com/feed.xml": false,
+		"http://127.0.0.1/feed.xml":               false,
+	}
+	for feedURL, wantOK := range tests {
+		err := guard.checkURL(context.Background(), feedURL)
+		if (err == nil) != wantOK {
+			t.Errorf("Wrong result for %v, got error: %v want allowed: %v", feedURL, err, wantOK)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+// event of the deliveries of new posts, sent in the X-Scraperss-Event header
+const webhookEventPostCreated = "post.created"
+
+// statuses of deliveries to webhooks
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+const (
+	// time between checks for due deliveries
+	webhookInterval = 5 * time.Second
+	// number of deliveries sent in parallel
+	webhookBatchSize = 20
+	// how long a delivery stays leased to the replica sending it
+	webhookLeaseDuration = time.Minute
+	// timeout for a single attempt to deliver to a webhook
+	webhookTimeout = 10 * time.Second
+	// how far the timestamp of a delivery may be off for receivers to accept
+	// it, deliveries captured by others can't be replayed after that
+	webhookTimestampTolerance = 5 * time.Minute
+)
+
+// number of attempts to deliver to webhooks by outcome, published on /debug/vars
+var webhookAttempts = expvar.NewMap("webhook_attempts")
+
+// webhookPayload is the body of the requests sent to webhooks
+type webhookPayload struct {
+	// ID of the delivery, the same for all attempts of it
+	ID        uuid.UUID   `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	WebhookID uuid.UUID   `json:"webhookId"`
+	Feed      webhookFeed `json:"feed"`
+	Post      Post        `json:"post"`
+}
+
+type webhookFeed struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Url  string    `json:"url"`
+}
+
+// enqueueWebhookDeliveries queues a delivery of each new post to the webhooks
+// it matches. It's called in the transaction saving the posts, so deliveries
+// are queued if and only if the posts are saved. Nothing is sent for the
+// first successful fetch of a feed, all of whose posts are new to us but not
+// new posts of the feed.
+func enqueueWebhookDeliveries(ctx context.Context, db *database.Queries, feed database.Feed, posts []Post, now time.Time) error {
+	if len(posts) == 0 || !feed.LastSuccessAt.Valid {
+		return nil
+	}
+	webhooks, err := db.GetWebhooksForFeed(ctx, feed.ID)
+	if err != nil {
+		return fmt.Errorf("couldn't get webhooks: %w", err)
+	}
+	params := database.CreateWebhookDeliveriesParams{CreatedAt: now}
+	for _, webhook := range webhooks {
+		for _, post := range posts {
+			if !webhookMatches(webhook, post) {
+				continue
+			}
+			payload := webhookPayload{
+				ID:        uuid.New(),
+				Event:     webhookEventPostCreated,
+				CreatedAt: now,
+				WebhookID: webhook.ID,
+				Feed:      webhookFeed{ID: feed.ID, Name: feed.Name, Url: feed.Url},
+				Post:      post,
+			}
+			dat, err := json.Marshal(payload)
+			if err != nil {
+				return fmt.Errorf("couldn't marshal webhook payload: %w", err)
+			}
+			params.Ids = append(params.Ids, payload.ID)
+			params.WebhookIds = append(params.WebhookIds, webhook.ID)
+			params.PostIds = append(params.PostIds, post.ID)
+			params.Payloads = append(params.Payloads, string(dat))
+		}
+	}
+	if len(params.Ids) == 0 {
+		return nil
+	}
+	err = db.CreateWebhookDeliveries(ctx, params)
+	if err != nil {
+		return fmt.Errorf("couldn't queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// webhookMatches reports whether a post is sent to a webhook, which is the
+// case if the webhook has no keywords or the title or description of the post
+// contains one of them, ignoring case
+func webhookMatches(webhook database.Webhook, post Post) bool {
+	if len(webhook.Keywords) == 0 {
+		return true
+	}
+	title := strings.ToLower(post.Title)
+	description := strings.ToLower(post.Description)
+	for _, keyword := range webhook.Keywords {
+		keyword = strings.ToLower(keyword)
+		if strings.Contains(title, keyword) || strings.Contains(description, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// signWebhookPayload returns the signature of a payload sent in the
+// X-Scraperss-Signature-256 header, the hex encoded HMAC-SHA256 of the
+// timestamp sent in the X-Scraperss-Timestamp header, a dot and the payload,
+// keyed with the secret of the webhook. Receivers reject deliveries whose
+// timestamp is off by more than webhookTimestampTolerance.
+func signWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSender sends the queued deliveries to webhooks
+type webhookSender struct {
+	db        *database.Queries
+	client    *http.Client
+	userAgent string
+}
+
+func newWebhookSender(db *database.Queries, guard *urlGuard, userAgent string) *webhookSender {
+	// webhooks are given by users, who must not reach the internal network
+	transport := guard.transport()
+	return &webhookSender{
+		db: db,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   webhookTimeout,
+			// a redirect doesn't confirm the delivery, it fails the attempt
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		userAgent: userAgent,
+	}
+}
+
+// startDelivering sends due deliveries to webhooks until ctx is cancelled.
+// Deliveries being sent when ctx is cancelled are finished.
+func startDelivering(ctx context.Context, conn *sql.DB, fetcher *feedFetcher, userAgent string) {
+	s := newWebhookSender(database.New(conn), fetcher.guard, userAgent)
+	slog.Info("Delivering to webhooks", "batch", webhookBatchSize, "interval", webhookInterval)
+	// the outcome of deliveries is saved even if they finish after ctx
+	workCtx := context.WithoutCancel(ctx)
+
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+	for {
+		// lease the next deliveries, other replicas skip them
+		deliveries, err := s.db.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+			LeaseSeconds: int32(webhookLeaseDuration.Seconds()),
+			Limit:        webhookBatchSize,
+		})
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Couldn't get deliveries to send", "error", err)
+		}
+		wg := sync.WaitGroup{}
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.deliver(workCtx, delivery)
+			}()
+		}
+		wg.Wait()
+
+		// more deliveries may be due if the batch was full
+		if len(deliveries) == webhookBatchSize && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopped delivering to webhooks")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver makes an attempt to send a leased delivery and saves its outcome.
+// Failed deliveries are retried with backoff until they failed too often.
+func (s *webhookSender) deliver(ctx context.Context, delivery database.WebhookDelivery) {
+	webhook, err := s.db.GetWebhookByID(ctx, delivery.WebhookID)
+	if err != nil {
+		slog.Error("Couldn't get the webhook of a delivery", "delivery", delivery.ID, "error", err)
+		return
+	}
+
+	start := time.Now()
+	statusCode, sendErr := s.send(ctx, webhook, delivery)
+	attempt := database.CreateWebhookDeliveryAttemptParams{
+		ID:         uuid.New(),
+		CreatedAt:  start.UTC(),
+		DeliveryID: delivery.ID,
+		StatusCode: sql.NullInt32{Int32: int32(statusCode), Valid: statusCode != 0},
+		DurationMs: int32(time.Since(start).Milliseconds()),
+	}
+	if sendErr != nil {
+		attempt.Error = sql.NullString{String: sendErr.Error(), Valid: true}
+	}
+	err = s.db.CreateWebhookDeliveryAttempt(ctx, attempt)
+	if err != nil {
+		slog.Error("Couldn't save the attempt of a delivery", "delivery", delivery.ID, "error", err)
+	}
+
+	if sendErr == nil {
+		webhookAttempts.Add(deliveryDelivered, 1)
+		err = s.db.MarkWebhookDeliveryDelivered(ctx, delivery.ID)
+		if err != nil {
+			slog.Error("Error marking the delivery as delivered", "delivery", delivery.ID, "error", err)
+		}
+		return
+	}
+
+	webhookAttempts.Add(deliveryFailed, 1)
+	slog.Warn("Couldn't deliver to webhook", "webhook", webhook.ID, "url", webhook.Url, "delivery", delivery.ID, "error", sendErr)
+	updated, err := s.db.MarkWebhookDeliveryFailed(ctx, database.MarkWebhookDeliveryFailedParams{
+		NextAttemptAt: time.Now().UTC().Add(webhookBackoff(delivery.Attempts + 1)),
+		MaxAttempts:   maxWebhookAttempts,
+		ID:            delivery.ID,
+	})
+	if err != nil {
+		slog.Error("Error marking the delivery as failed", "delivery", delivery.ID, "error", err)
+		return
+	}
+	if updated.Status == deliveryFailed {
+		slog.Warn("Giving up on delivery after too many attempts", "webhook", webhook.ID, "delivery", delivery.ID, "attempts", updated.Attempts)
+	}
+}
+
+// send posts the payload of a delivery to its webhook, which must answer
+// with a 2xx status. It returns the status of the response, 0 if there was
+// none.
+func (s *webhookSender) send(ctx context.Context, webhook database.Webhook, delivery database.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.userAgent)
+	req.Header.Set("X-Scraperss-Event", webhookEventPostCreated)
+	req.Header.Set("X-Scraperss-Delivery", delivery.ID.String())
+	// every attempt is signed anew, so retries are within the tolerance
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Scraperss-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Scraperss-Signature-256", signWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if errors.Is(err, errUnsafeAddress) {
+			return 0, fmt.Errorf("the URL of the webhook is not allowed: %w", err)
+		}
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// read a bit of the body, so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.StatusCode, nil
+}
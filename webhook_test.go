@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hammadzf/scraperss/internal/database"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	// key and data of HMAC-SHA256 test case 2 of RFC 4231, after the timestamp
+	got := signWebhookPayload("Jefe", 1700000000, []byte("what do ya want for nothing?"))
+	want := "sha256=1cdd0650c8be1cb0974b1788d458b1e781206cfef59b85faafc582d2e182c57e"
+	if got != want {
+		t.Errorf("Wrong signature, got: %v want: %v", got, want)
+	}
+	// a replayed payload with a fresh timestamp doesn't match the signature
+	if replayed := signWebhookPayload("Jefe", 1700000600, []byte("what do ya want for nothing?")); replayed == want {
+		t.Errorf("Signature doesn't cover the timestamp")
+	}
+}
+
+func TestWebhookMatches(t *testing.T) {
+	post := Post{Title: "Go 1.24 is released", Description: "Generic type aliases and faster maps"}
+	tests := map[string]struct {
+		keywords []string
+		want     bool
+	}{
+		"no keywords":         {nil, true},
+		"keyword in title":    {[]string{"go 1.24"}, true},
+		"keyword in summary":  {[]string{"MAPS"}, true},
+		"one of the keywords": {[]string{"rust", "generic"}, true},
+		"no keyword matches":  {[]string{"rust", "zig"}, false},
+	}
+	for name, test := range tests {
+		webhook := database.Webhook{Keywords: test.keywords}
+		if got := webhookMatches(webhook, post); got != test.want {
+			t.Errorf("Wrong match for %v, got: %v want: %v", name, got, test.want)
+		}
+	}
+}
+
+func TestEnqueueWebhookDeliveriesFirstFetch(t *testing.T) {
+	// the backlog of a feed fetched for the first time is not sent, so the
+	// webhooks aren't even looked up in the database
+	feed := database.Feed{ID: uuid.New()}
+	err := enqueueWebhookDeliveries(context.Background(), nil, feed, []Post{{ID: uuid.New(), Title: "Old post"}}, time.Now())
+	if err != nil {
+		t.Errorf("Failed to skip the posts of the first fetch: %v", err)
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	payload := `{"event":"post.created"}`
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		dat, _ := io.ReadAll(r.Body)
+		if string(dat) != payload {
+			t.Errorf("Wrong payload, got: %s want: %s", dat, payload)
+		}
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-Scraperss-Timestamp"), 10, 64)
+		if err != nil || time.Since(time.Unix(timestamp, 0)).Abs() > webhookTimestampTolerance {
+			t.Errorf("Wrong timestamp, got: %v", r.Header.Get("X-Scraperss-Timestamp"))
+		}
+		if got, want := r.Header.Get("X-Scraperss-Signature-256"), signWebhookPayload("secret", timestamp, dat); got != want {
+			t.Errorf("Wrong signature, got: %v want: %v", got, want)
+		}
+		if got := r.Header.Get("X-Scraperss-Event"); got != webhookEventPostCreated {
+			t.Errorf("Wrong event, got: %v want: %v", got, webhookEventPostCreated)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	sender := newWebhookSender(nil, newURLGuard([]string{"127.0.0.1"}), "scraperss-test")
+	tests := map[string]struct {
+		status  int
+		wantErr bool
+	}{
+		"/ok":       {http.StatusNoContent, false},
+		"/error":    {http.StatusInternalServerError, true},
+		"/redirect": {http.StatusFound, true},
+	}
+	for path, test := range tests {
+		webhook := database.Webhook{Url: srv.URL + path, Secret: "secret"}
+		delivery := database.WebhookDelivery{ID: uuid.New(), Payload: payload}
+		status, err := sender.send(context.Background(), webhook, delivery)
+		if status != test.status {
+			t.Errorf("Wrong status for %v, got: %v want: %v", path, status, test.status)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("Wrong error for %v, got: %v want error: %v", path, err, test.wantErr)
+		}
+	}
+
+	// webhooks can't reach the internal network
+	blocked := newWebhookSender(nil, newURLGuard(nil), "scraperss-test")
+	status, err := blocked.send(context.Background(), database.Webhook{Url: srv.URL + "/ok"}, database.WebhookDelivery{Payload: payload})
+	if err == nil || status != 0 {
+		t.Errorf("Delivery to a blocked address didn't fail, got status: %v error: %v", status, err)
+	}
+}